@@ -0,0 +1,191 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const defaultAgentAsToolMaxSteps = 10
+
+type AgentAsToolOptions struct {
+	// Name and Description present the agent to callers, e.g. "ask_billing_agent".
+	Name        string
+	Description string
+	// OutputSchema, if set, asks the agent to finish with a JSON object matching this schema, which
+	// is returned as structured content. Answers that don't match are reported as errors.
+	OutputSchema map[string]any
+	// Annotations are published along with the tool when served over MCP.
+	Annotations *mcp.ToolAnnotations
+	// MaxSteps bounds the number of model calls per task. Defaults to 10.
+	MaxSteps        int
+	ProviderOptions fantasy.ProviderOptions
+}
+
+type agentAsToolInput struct {
+	Task    string `json:"task" description:"The task for the agent, phrased as a self-contained request"`
+	Context string `json:"context,omitempty" description:"Background information the agent may need"`
+}
+
+// NewAgentAsTool wraps an agent, assembled from the same pieces as for AGUIHandler, into a tool
+// taking a task and answering with the agent's final message. Publish it to MCP clients with
+// NewMCPToolServer, or give it to another agent as a sub-agent.
+//
+// Each task runs the agent loop anew with the system prompt and tools resolved for the call's
+// context. Steps and tool calls are reported as progress through WithMCPProgress, which
+// NewMCPToolServer turns into MCP progress notifications.
+func NewAgentAsTool(model fantasy.LanguageModel, spg SystemPromptGenerator, toolFetcher ToolFetcher, options AgentAsToolOptions) MCPAgentTool {
+	if options.MaxSteps <= 0 {
+		options.MaxSteps = defaultAgentAsToolMaxSteps
+	}
+	t := &agentAsTool{model: model, spg: spg, toolFetcher: toolFetcher, options: options}
+	t.AgentTool = fantasy.NewAgentTool(options.Name, options.Description, t.run)
+	return t
+}
+
+type agentAsTool struct {
+	fantasy.AgentTool
+	model       fantasy.LanguageModel
+	spg         SystemPromptGenerator
+	toolFetcher ToolFetcher
+	options     AgentAsToolOptions
+}
+
+func (t *agentAsTool) OutputSchema() map[string]any {
+	return t.options.OutputSchema
+}
+
+func (t *agentAsTool) MCPTool() *mcp.Tool {
+	tool := mcpServerTool(t.AgentTool)
+	tool.Annotations = t.options.Annotations
+	if t.options.OutputSchema != nil {
+		tool.OutputSchema = t.options.OutputSchema
+	}
+	return tool
+}
+
+func (t *agentAsTool) Annotations() *mcp.ToolAnnotations {
+	return t.options.Annotations
+}
+
+func (t *agentAsTool) run(ctx context.Context, input agentAsToolInput, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	if strings.TrimSpace(input.Task) == "" {
+		return fantasy.NewTextErrorResponse("a task is required"), nil
+	}
+	progress := &agentAsToolProgress{toolCallID: call.ID, toolName: t.options.Name}
+	if fn, ok := mcpProgressFromContext(ctx); ok {
+		progress.fn = fn
+		// progress of the agent's own tools is folded into the agent's progress
+		ctx = WithMCPProgress(ctx, func(ctx context.Context, p MCPProgress) {
+			if p.Message != "" {
+				progress.report(ctx, p.ToolName+": "+p.Message)
+			}
+		})
+	}
+
+	systemPrompt := ""
+	if t.spg != nil {
+		systemPrompt = t.spg(ctx)
+	}
+	if t.options.OutputSchema != nil {
+		schema, err := json.Marshal(t.options.OutputSchema)
+		if err != nil {
+			return fantasy.NewTextErrorResponse(fmt.Sprintf("invalid output schema of agent %s: %v", t.options.Name, err)), nil
+		}
+		systemPrompt = strings.TrimSpace(systemPrompt + "\n\nWhen done, answer with only a JSON object matching this schema:\n" + string(schema))
+	}
+	var tools []fantasy.AgentTool
+	if t.toolFetcher != nil {
+		for _, tool := range t.toolFetcher(ctx) {
+			tools = append(tools, &progressReportingTool{AgentTool: tool, progress: progress})
+		}
+	}
+
+	agent := fantasy.NewAgent(t.model, fantasy.WithSystemPrompt(systemPrompt), fantasy.WithTools(tools...))
+	prompt := input.Task
+	if input.Context != "" {
+		prompt += "\n\nContext:\n" + input.Context
+	}
+	result, err := agent.Generate(ctx, fantasy.AgentCall{
+		Prompt:          prompt,
+		StopWhen:        []fantasy.StopCondition{fantasy.StepCountIs(t.options.MaxSteps)},
+		ProviderOptions: t.options.ProviderOptions,
+		PrepareStep: func(ctx context.Context, options fantasy.PrepareStepFunctionOptions) (context.Context, fantasy.PrepareStepResult, error) {
+			progress.report(ctx, fmt.Sprintf("step %d", options.StepNumber+1))
+			return ctx, fantasy.PrepareStepResult{}, nil
+		},
+	})
+	if err != nil {
+		return fantasy.NewTextErrorResponse(fmt.Sprintf("agent %s failed: %v", t.options.Name, err)), nil
+	}
+
+	answer := result.Response.Content.Text()
+	if t.options.OutputSchema == nil {
+		return fantasy.NewTextResponse(answer), nil
+	}
+	structured, err := parseAgentJSONAnswer(answer)
+	if err != nil {
+		return fantasy.NewTextErrorResponse(fmt.Sprintf("agent %s did not answer with JSON: %v\n%s", t.options.Name, err, answer)), nil
+	}
+	schema, err := resolveMCPValidationSchema(t.options.OutputSchema)
+	if err != nil {
+		return fantasy.NewTextErrorResponse(fmt.Sprintf("invalid output schema of agent %s: %v", t.options.Name, err)), nil
+	}
+	if err := validateMCPStructuredContent(structured, schema); err != nil {
+		return fantasy.NewTextErrorResponse(fmt.Sprintf("the answer of agent %s does not match its output schema: %v\n%s",
+			t.options.Name, err, answer)), nil
+	}
+	return withMCPResponseMetadata(fantasy.NewTextResponse(answer), MCPToolStructuredContentMetadataKey, structured), nil
+}
+
+// parseAgentJSONAnswer decodes an answer that should be a JSON object, tolerating a code fence around it.
+func parseAgentJSONAnswer(answer string) (any, error) {
+	answer = strings.TrimSpace(answer)
+	if fenced, ok := strings.CutPrefix(answer, "```"); ok {
+		fenced = strings.TrimPrefix(fenced, "json")
+		answer = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fenced), "```"))
+	}
+	var structured map[string]any
+	if err := json.Unmarshal([]byte(answer), &structured); err != nil {
+		return nil, err
+	}
+	return structured, nil
+}
+
+// agentAsToolProgress reports the progress of a task, counting steps and tool calls, as the total
+// isn't known in advance.
+type agentAsToolProgress struct {
+	fn         MCPProgressFunc
+	toolCallID string
+	toolName   string
+
+	mu    sync.Mutex
+	count float64
+}
+
+func (p *agentAsToolProgress) report(ctx context.Context, message string) {
+	if p.fn == nil {
+		return
+	}
+	// tools may run concurrently; holding the lock keeps the reported progress increasing
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count++
+	p.fn(ctx, MCPProgress{ToolCallID: p.toolCallID, ToolName: p.toolName, Progress: p.count, Message: message})
+}
+
+// progressReportingTool reports calls to the tools of an agent run by NewAgentAsTool.
+type progressReportingTool struct {
+	fantasy.AgentTool
+	progress *agentAsToolProgress
+}
+
+func (t *progressReportingTool) Run(ctx context.Context, params fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	t.progress.report(ctx, "calling "+t.Info().Name)
+	return t.AgentTool.Run(ctx, params)
+}
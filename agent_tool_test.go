@@ -0,0 +1,178 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// scriptedLanguageModel plays back responses, one per call, and records the calls it received.
+type scriptedLanguageModel struct {
+	mu        sync.Mutex
+	responses []*fantasy.Response
+	calls     []fantasy.Call
+}
+
+func (m *scriptedLanguageModel) Generate(_ context.Context, call fantasy.Call) (*fantasy.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, call)
+	if len(m.responses) == 0 {
+		return nil, errors.New("no more responses")
+	}
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return resp, nil
+}
+
+// Stream plays back the next response as a stream.
+func (m *scriptedLanguageModel) Stream(ctx context.Context, call fantasy.Call) (fantasy.StreamResponse, error) {
+	resp, err := m.Generate(ctx, call)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(fantasy.StreamPart) bool) {
+		for i, content := range resp.Content {
+			var parts []fantasy.StreamPart
+			switch content := content.(type) {
+			case fantasy.TextContent:
+				id := fmt.Sprintf("text-%d", i)
+				parts = []fantasy.StreamPart{
+					{Type: fantasy.StreamPartTypeTextStart, ID: id},
+					{Type: fantasy.StreamPartTypeTextDelta, ID: id, Delta: content.Text},
+					{Type: fantasy.StreamPartTypeTextEnd, ID: id},
+				}
+			case fantasy.ToolCallContent:
+				parts = []fantasy.StreamPart{{Type: fantasy.StreamPartTypeToolCall, ID: content.ToolCallID, ToolCallName: content.ToolName, ToolCallInput: content.Input}}
+			}
+			for _, part := range parts {
+				if !yield(part) {
+					return
+				}
+			}
+		}
+		yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeFinish, FinishReason: resp.FinishReason, Usage: resp.Usage})
+	}, nil
+}
+
+func (m *scriptedLanguageModel) Provider() string { return "scripted" }
+
+func (m *scriptedLanguageModel) Model() string { return "scripted-model" }
+
+func newBillingAgentModel(answer string) *scriptedLanguageModel {
+	return &scriptedLanguageModel{responses: []*fantasy.Response{
+		{
+			Content:      fantasy.ResponseContent{fantasy.ToolCallContent{ToolCallID: "lookup-1", ToolName: "lookup_invoice", Input: `{"message": "INV-7"}`}},
+			FinishReason: fantasy.FinishReasonToolCalls,
+		},
+		{
+			Content:      fantasy.ResponseContent{fantasy.TextContent{Text: answer}},
+			FinishReason: fantasy.FinishReasonStop,
+		},
+	}}
+}
+
+func newBillingAgentTool(model fantasy.LanguageModel, outputSchema map[string]any) MCPAgentTool {
+	lookupInvoice := fantasy.NewAgentTool("lookup_invoice", "Look up an invoice", func(_ context.Context, input echoInput, _ fantasy.ToolCall) (fantasy.ToolResponse, error) {
+		return fantasy.NewTextResponse(input.Message + ": 120 EUR, paid"), nil
+	})
+	return NewAgentAsTool(model,
+		func(context.Context) string { return "You answer billing questions." },
+		func(context.Context) []fantasy.AgentTool { return []fantasy.AgentTool{lookupInvoice} },
+		AgentAsToolOptions{Name: "ask_billing_agent", Description: "Ask the billing agent", OutputSchema: outputSchema},
+	)
+}
+
+func TestNewAgentAsTool_ServedOverMCP(t *testing.T) {
+	t.Parallel()
+	// Given
+	model := newBillingAgentModel("Invoice INV-7 was paid.")
+	var mu sync.Mutex
+	var progress []string
+	session := connectMCPServer(t, NewMCPToolServer([]fantasy.AgentTool{newBillingAgentTool(model, nil)}, MCPToolServerOptions{}), &mcp.ClientOptions{
+		ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress = append(progress, req.Params.Message)
+		},
+	})
+	params := &mcp.CallToolParams{Name: "ask_billing_agent", Arguments: map[string]any{"task": "Was INV-7 paid?"}, Meta: mcp.Meta{}}
+	params.SetProgressToken("token-1")
+
+	// When
+	result, err := session.CallTool(context.Background(), params)
+
+	// Then
+	if err != nil || result.IsError {
+		t.Fatalf("unexpected error: %v %+v", err, result)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; text != "Invoice INV-7 was paid." {
+		t.Fatalf("unexpected answer: %q", text)
+	}
+	if system := model.calls[0].Prompt[0]; system.Role != fantasy.MessageRoleSystem || system.Content[0].(fantasy.TextPart).Text != "You answer billing questions." {
+		t.Fatalf("expected the system prompt to be used, got %+v", system)
+	}
+	expected := "step 1,calling lookup_invoice,step 2"
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		got := strings.Join(progress, ",")
+		mu.Unlock()
+		if got == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected progress %q, got %q", expected, progress)
+}
+
+func TestNewAgentAsTool_StructuredOutput(t *testing.T) {
+	t.Parallel()
+	outputSchema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"paid": map[string]any{"type": "boolean"}},
+		"required":   []any{"paid"},
+	}
+	tests := []struct {
+		name               string
+		answer             string
+		expectedIsError    bool
+		expectedStructured any
+	}{
+		{name: "matching answer", answer: "```json\n{\"paid\": true}\n```", expectedStructured: map[string]any{"paid": true}},
+		{name: "not JSON", answer: "It was paid.", expectedIsError: true},
+		{name: "not matching the schema", answer: `{"paid": "yes"}`, expectedIsError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			tool := newBillingAgentTool(newBillingAgentModel(tt.answer), outputSchema)
+			session := connectMCPServer(t, NewMCPToolServer([]fantasy.AgentTool{tool}, MCPToolServerOptions{}), nil)
+
+			// When
+			result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "ask_billing_agent", Arguments: map[string]any{"task": "Was INV-7 paid?"}})
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError != tt.expectedIsError {
+				t.Fatalf("expected is error %v, got %+v", tt.expectedIsError, result)
+			}
+			if tt.expectedStructured != nil {
+				if !reflect.DeepEqual(result.StructuredContent, tt.expectedStructured) {
+					t.Fatalf("expected structured content %v, got %v", tt.expectedStructured, result.StructuredContent)
+				}
+			}
+		})
+	}
+}
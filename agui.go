@@ -3,9 +3,11 @@ package fantasyextensions
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 
 	"charm.land/fantasy"
 	"github.com/ag-ui-protocol/ag-ui/sdks/community/go/pkg/core/events"
@@ -51,12 +53,31 @@ func AGUIHandler(model fantasy.LanguageModel, spg SystemPromptGenerator, toolFet
 		state := input.State
 		messages := input.toMessages()
 
+		streamWriter := newStreamWriter(w)
+
 		var agentContext context.Context
 		if state != nil {
 			agentContext = context.WithValue(r.Context(), AgentContextStateKey, state)
 		} else {
 			agentContext = r.Context()
 		}
+		run := &aguiRun{
+			threadID: threadID,
+			runID:    runID,
+			writer:   streamWriter,
+		}
+		// nothing may be emitted on behalf of the run once the handler has returned
+		defer run.finish()
+		agentContext = context.WithValue(agentContext, aguiRunContextKey{}, run)
+		agentContext = WithMCPProgress(agentContext, run.emitToolProgress)
+
+		// the tool fetcher and system prompt generator may already emit events, e.g. when MCP servers
+		// they consult log or ask the user for input
+		if err := streamWriter.WriteEvent(r.Context(), events.NewRunStartedEvent(threadID, runID)); err != nil {
+			log.Printf("error writing run started event: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		var prompt string
 		if len(messages) == 0 {
@@ -73,6 +94,7 @@ func AGUIHandler(model fantasy.LanguageModel, spg SystemPromptGenerator, toolFet
 		if toolFetcher != nil {
 			tools = toolFetcher(agentContext)
 		}
+		outputSchemas := aguiOutputSchemas(tools)
 
 		agent := fantasy.NewAgent(
 			model,
@@ -84,13 +106,6 @@ func AGUIHandler(model fantasy.LanguageModel, spg SystemPromptGenerator, toolFet
 		messageIDs := make(map[string]string)
 		reasoningIDs := make(map[string]string)
 
-		streamWriter := newStreamWriter(w)
-		if err := streamWriter.WriteEvent(r.Context(), events.NewRunStartedEvent(threadID, runID)); err != nil {
-			log.Printf("error writing run started event: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
 		streamCall := fantasy.AgentStreamCall{
 			Prompt: prompt,
 
@@ -230,8 +245,8 @@ func AGUIHandler(model fantasy.LanguageModel, spg SystemPromptGenerator, toolFet
 			// When a tool call completes, send the result to the browser.
 			// This should never return an error to avoid interrupting the agent flow.
 			OnToolResult: func(res fantasy.ToolResultContent) error {
+				var metadata map[string]any
 				if res.ClientMetadata != "" {
-					var metadata map[string]any
 					if err := json.Unmarshal([]byte(res.ClientMetadata), &metadata); err != nil {
 						log.Printf("OnToolResult: error: failed to unmarshal client metadata: %v", err)
 						return nil
@@ -289,10 +304,18 @@ func AGUIHandler(model fantasy.LanguageModel, spg SystemPromptGenerator, toolFet
 					log.Printf("error writing tool call result event: %v", err)
 					return nil
 				}
+				// what the tool returned beyond the content given to the model
+				for _, e := range aguiToolResultEvents(res, metadata, outputSchemas) {
+					if err := streamWriter.WriteEvent(r.Context(), e); err != nil {
+						log.Printf("error writing tool result event: %v", err)
+						return nil
+					}
+				}
 				return nil
 			},
 
 			OnAgentFinish: func(result *fantasy.AgentResult) error {
+				run.finish()
 				e := events.NewRunFinishedEvent(threadID, runID)
 				if err := streamWriter.WriteEvent(r.Context(), e); err != nil {
 					log.Printf("error writing run finished event: %v", err)
@@ -303,6 +326,7 @@ func AGUIHandler(model fantasy.LanguageModel, spg SystemPromptGenerator, toolFet
 
 			OnError: func(err error) {
 				log.Printf("agent streaming on error: %v", err)
+				run.finish()
 				e := events.NewRunErrorEvent(err.Error(), events.WithRunID(runID))
 				if err := streamWriter.WriteEvent(r.Context(), e); err != nil {
 					log.Printf("error writing run error event: %v", err)
@@ -460,9 +484,149 @@ func aguiMessageToFantasyMessage(message map[string]any) fantasy.Message {
 	}
 }
 
+// AGUIToolStructuredContentEventName is the name of the AG-UI custom event carrying the structured
+// output of a tool call, along with the tool's output schema if it declares one, so that the UI can
+// render it.
+const AGUIToolStructuredContentEventName = "tool_structured_content"
+
+// AGUIToolStructuredContent is the value of the "tool_structured_content" event.
+type AGUIToolStructuredContent struct {
+	ToolCallID        string         `json:"tool_call_id"`
+	ToolName          string         `json:"tool_name"`
+	StructuredContent any            `json:"structured_content"`
+	OutputSchema      map[string]any `json:"output_schema,omitempty"`
+}
+
+// AGUIToolOriginalOutputEventName is the name of the AG-UI custom event carrying the full output of
+// a tool call whose output MCPOutputPolicy shortened before it reached the model.
+const AGUIToolOriginalOutputEventName = "tool_original_output"
+
+// AGUIToolOriginalOutput is the value of the "tool_original_output" event.
+type AGUIToolOriginalOutput struct {
+	ToolCallID string `json:"tool_call_id"`
+	ToolName   string `json:"tool_name"`
+	MCPOriginalOutput
+}
+
+// AGUIToolMediaEventName is the name of the AG-UI custom event carrying the images, audio and other
+// binary content returned by a tool call, which the model only sees references to.
+const AGUIToolMediaEventName = "tool_media"
+
+// AGUIToolMedia is the value of the "tool_media" event.
+type AGUIToolMedia struct {
+	ToolCallID string         `json:"tool_call_id"`
+	ToolName   string         `json:"tool_name"`
+	Media      []MCPToolMedia `json:"media"`
+}
+
+// aguiOutputSchemas returns the output schemas of the tools that declare one, by tool name.
+func aguiOutputSchemas(tools []fantasy.AgentTool) map[string]map[string]any {
+	schemas := make(map[string]map[string]any)
+	for _, tool := range tools {
+		if withSchema, ok := tool.(interface{ OutputSchema() map[string]any }); ok && withSchema.OutputSchema() != nil {
+			schemas[tool.Info().Name] = withSchema.OutputSchema()
+		}
+	}
+	return schemas
+}
+
+// aguiToolResultEvents returns the events forwarding the parts of a tool result's metadata meant
+// for the UI.
+func aguiToolResultEvents(res fantasy.ToolResultContent, metadata map[string]any, outputSchemas map[string]map[string]any) []events.Event {
+	var result []events.Event
+	if structured, ok := metadata[MCPToolStructuredContentMetadataKey]; ok {
+		result = append(result, events.NewCustomEvent(AGUIToolStructuredContentEventName, events.WithValue(AGUIToolStructuredContent{
+			ToolCallID:        res.ToolCallID,
+			ToolName:          res.ToolName,
+			StructuredContent: structured,
+			OutputSchema:      outputSchemas[res.ToolName],
+		})))
+	}
+	if original, ok := decodeAGUIMetadata[MCPOriginalOutput](metadata, MCPToolOriginalOutputMetadataKey); ok {
+		result = append(result, events.NewCustomEvent(AGUIToolOriginalOutputEventName, events.WithValue(AGUIToolOriginalOutput{
+			ToolCallID:        res.ToolCallID,
+			ToolName:          res.ToolName,
+			MCPOriginalOutput: original,
+		})))
+	}
+	if media, ok := decodeAGUIMetadata[[]MCPToolMedia](metadata, MCPToolMediaMetadataKey); ok && len(media) > 0 {
+		result = append(result, events.NewCustomEvent(AGUIToolMediaEventName, events.WithValue(AGUIToolMedia{
+			ToolCallID: res.ToolCallID,
+			ToolName:   res.ToolName,
+			Media:      media,
+		})))
+	}
+	return result
+}
+
+// decodeAGUIMetadata decodes the value of key in tool result metadata, which has been through JSON.
+func decodeAGUIMetadata[T any](metadata map[string]any, key string) (T, bool) {
+	var value T
+	raw, ok := metadata[key]
+	if !ok {
+		return value, false
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return value, false
+	}
+	if err := json.Unmarshal(b, &value); err != nil {
+		log.Printf("failed to decode %s tool result metadata: %v", key, err)
+		return value, false
+	}
+	return value, true
+}
+
+// aguiRun gives code running within an AGUIHandler run (such as MCP tools) access to the event stream.
+type aguiRun struct {
+	threadID string
+	runID    string
+	writer   *streamWriter
+	// done is set, under writer.mu, once the run has finished or failed
+	done bool
+}
+
+// errAGUIRunFinished is returned when emitting an event for a run that has already finished.
+var errAGUIRunFinished = errors.New("AG-UI run has finished")
+
+type aguiRunContextKey struct{}
+
+func aguiRunFromContext(ctx context.Context) (*aguiRun, bool) {
+	run, ok := ctx.Value(aguiRunContextKey{}).(*aguiRun)
+	return run, ok
+}
+
+func (r *aguiRun) emit(ctx context.Context, event events.Event) error {
+	r.writer.mu.Lock()
+	defer r.writer.mu.Unlock()
+	if r.done {
+		return errAGUIRunFinished
+	}
+	return r.writer.writeEvent(ctx, event)
+}
+
+// finish stops events from being emitted for the run, so that none follow RUN_FINISHED or
+// RUN_ERROR, or are written after the handler has returned.
+func (r *aguiRun) finish() {
+	r.writer.mu.Lock()
+	defer r.writer.mu.Unlock()
+	r.done = true
+}
+
+// AGUIToolProgressEventName is the name of the AG-UI custom event reporting the progress of a tool call.
+// Its value is an MCPProgress, tied to the tool call by "tool_call_id".
+const AGUIToolProgressEventName = "tool_progress"
+
+func (r *aguiRun) emitToolProgress(ctx context.Context, progress MCPProgress) {
+	if err := r.emit(ctx, events.NewCustomEvent(AGUIToolProgressEventName, events.WithValue(progress))); err != nil {
+		log.Printf("error writing tool progress event: %v", err)
+	}
+}
+
 type streamWriter struct {
 	w http.ResponseWriter
 	// internal
+	mu        sync.Mutex
 	sseWriter *sse.SSEWriter
 	flusher   http.Flusher
 }
@@ -482,6 +646,13 @@ func newStreamWriter(w http.ResponseWriter) *streamWriter {
 }
 
 func (s *streamWriter) WriteEvent(ctx context.Context, event events.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeEvent(ctx, event)
+}
+
+// writeEvent writes event; s.mu must be held.
+func (s *streamWriter) writeEvent(ctx context.Context, event events.Event) error {
 	if err := s.sseWriter.WriteEvent(ctx, s.w, event); err != nil {
 		return err
 	}
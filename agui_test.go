@@ -0,0 +1,189 @@
+package fantasyextensions
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/ag-ui-protocol/ag-ui/sdks/community/go/pkg/core/events"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// aguiCustomEvents runs handler on a new thread and returns the values of the custom events it
+// emitted, by event name.
+func aguiCustomEvents(t *testing.T, handler http.Handler) map[string][]json.RawMessage {
+	t.Helper()
+	body := `{"thread_id": "thread-1", "run_id": "run-1"}`
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/agui", strings.NewReader(body)))
+
+	output := recorder.Body.String()
+	if !strings.Contains(output, `"type":"RUN_FINISHED"`) {
+		t.Fatalf("expected the run to finish, got %s", output)
+	}
+	customEvents := map[string][]json.RawMessage{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type  string          `json:"type"`
+			Name  string          `json:"name"`
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+		if event.Type == "CUSTOM" {
+			customEvents[event.Name] = append(customEvents[event.Name], event.Value)
+		}
+	}
+	return customEvents
+}
+
+// newToolCallingModel returns a model calling a tool, then answering.
+func newToolCallingModel(toolName, input string) *scriptedLanguageModel {
+	return &scriptedLanguageModel{responses: []*fantasy.Response{
+		{
+			Content:      fantasy.ResponseContent{fantasy.ToolCallContent{ToolCallID: "call-1", ToolName: toolName, Input: input}},
+			FinishReason: fantasy.FinishReasonToolCalls,
+		},
+		{
+			Content:      fantasy.ResponseContent{fantasy.TextContent{Text: "Done."}},
+			FinishReason: fantasy.FinishReasonStop,
+		},
+	}}
+}
+
+// newMCPToolsAGUIHandler returns an AGUIHandler driven by model, with the tools of server.
+func newMCPToolsAGUIHandler(t *testing.T, model fantasy.LanguageModel, server *mcp.Server, options MCPToolsOptions) http.Handler {
+	t.Helper()
+	sessionMaker, _ := newTestMCPSessionMaker(t, server, nil)
+	tools, err := MCPToolsWithOptions(context.Background(), sessionMaker, options)
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	return AGUIHandler(model,
+		func(context.Context) string { return "You help." },
+		func(context.Context) []fantasy.AgentTool { return tools },
+		AGUIHandlerOptions{},
+	)
+}
+
+func TestAGUIHandler_ForwardsStructuredContent(t *testing.T) {
+	t.Parallel()
+	// Given
+	handler := newMCPToolsAGUIHandler(t, newToolCallingModel("forecast", `{"city": "London"}`), newWeatherMCPServer(), MCPToolsOptions{})
+
+	// When
+	customEvents := aguiCustomEvents(t, handler)
+
+	// Then
+	if len(customEvents[AGUIToolStructuredContentEventName]) != 1 {
+		t.Fatalf("expected a %s event, got %v", AGUIToolStructuredContentEventName, customEvents)
+	}
+	var value AGUIToolStructuredContent
+	if err := json.Unmarshal(customEvents[AGUIToolStructuredContentEventName][0], &value); err != nil {
+		t.Fatalf("invalid event value: %v", err)
+	}
+	if value.ToolCallID != "call-1" || value.ToolName != "forecast" {
+		t.Fatalf("expected the event to be tied to the tool call, got %+v", value)
+	}
+	if content, _ := value.StructuredContent.(map[string]any); content["temperature"] != 21.5 {
+		t.Fatalf("unexpected structured content: %v", value.StructuredContent)
+	}
+	if properties, _ := value.OutputSchema["properties"].(map[string]any); properties["temperature"] == nil {
+		t.Fatalf("expected the output schema, got %v", value.OutputSchema)
+	}
+}
+
+func TestAGUIHandler_ForwardsOriginalOutput(t *testing.T) {
+	t.Parallel()
+	// Given
+	handler := newMCPToolsAGUIHandler(t, newToolCallingModel("tail_logs", "{}"), newVerboseMCPServer(), MCPToolsOptions{Output: MCPOutputPolicy{MaxTokens: 250}})
+
+	// When
+	customEvents := aguiCustomEvents(t, handler)
+
+	// Then
+	if len(customEvents[AGUIToolOriginalOutputEventName]) != 1 {
+		t.Fatalf("expected a %s event, got %v", AGUIToolOriginalOutputEventName, customEvents)
+	}
+	var value AGUIToolOriginalOutput
+	if err := json.Unmarshal(customEvents[AGUIToolOriginalOutputEventName][0], &value); err != nil {
+		t.Fatalf("invalid event value: %v", err)
+	}
+	if value.ToolCallID != "call-1" || value.Method != MCPOutputTruncated {
+		t.Fatalf("expected the truncated output of the tool call, got %s %s", value.ToolCallID, value.Method)
+	}
+	if !strings.Contains(value.Content, "line 0500") {
+		t.Fatalf("expected the full output, got %d bytes", len(value.Content))
+	}
+}
+
+func TestAGUIHandler_ForwardsMedia(t *testing.T) {
+	t.Parallel()
+	// Given
+	handler := newMCPToolsAGUIHandler(t, newToolCallingModel("screenshot", "{}"), newScreenshotMCPServer(t), MCPToolsOptions{})
+
+	// When
+	customEvents := aguiCustomEvents(t, handler)
+
+	// Then
+	if len(customEvents[AGUIToolMediaEventName]) != 1 {
+		t.Fatalf("expected a %s event, got %v", AGUIToolMediaEventName, customEvents)
+	}
+	var value AGUIToolMedia
+	if err := json.Unmarshal(customEvents[AGUIToolMediaEventName][0], &value); err != nil {
+		t.Fatalf("invalid event value: %v", err)
+	}
+	if value.ToolCallID != "call-1" || len(value.Media) != 2 || value.Media[0].MediaType != "image/png" || value.Media[1].Type != "audio" {
+		t.Fatalf("expected the image and audio of the tool call, got %+v", value)
+	}
+}
+
+func TestAGUIHandler_StartsRunBeforeFetchingTools(t *testing.T) {
+	t.Parallel()
+	// Given
+	emitting := func(ctx context.Context, name string) {
+		run, ok := aguiRunFromContext(ctx)
+		if !ok {
+			t.Errorf("expected %s to run within the run", name)
+			return
+		}
+		if err := run.emit(ctx, events.NewCustomEvent(name)); err != nil {
+			t.Errorf("failed to emit from %s: %v", name, err)
+		}
+	}
+	handler := AGUIHandler(&fakeLanguageModel{name: "default-model", reply: "Hi."},
+		func(ctx context.Context) string {
+			emitting(ctx, "system_prompt")
+			return "You help."
+		},
+		func(ctx context.Context) []fantasy.AgentTool {
+			emitting(ctx, "tools")
+			return nil
+		},
+		AGUIHandlerOptions{},
+	)
+	recorder := httptest.NewRecorder()
+
+	// When
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/agui", strings.NewReader(`{"thread_id": "thread-1", "run_id": "run-1"}`)))
+
+	// Then
+	output := recorder.Body.String()
+	started := strings.Index(output, `"type":"RUN_STARTED"`)
+	for _, name := range []string{"tools", "system_prompt"} {
+		if i := strings.Index(output, `"name":"`+name+`"`); i < 0 || started < 0 || i < started {
+			t.Fatalf("expected the %s event after RUN_STARTED, got %s", name, output)
+		}
+	}
+}
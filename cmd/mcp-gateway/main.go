@@ -0,0 +1,211 @@
+// Command mcp-gateway serves the tools, resources and prompts of several MCP servers as one.
+//
+//	mcp-gateway -config gateway.json
+//
+// The config file lists the upstream servers, started as a subprocess or reached over streamable
+// HTTP. Values of env and headers may refer to environment variables, e.g. "Bearer ${DOCS_TOKEN}".
+//
+//	{
+//	  "listen": ":8080",
+//	  "auth_token_env": "GATEWAY_TOKEN",
+//	  "servers": [
+//	    {"name": "time", "command": "uvx", "args": ["mcp-server-time"], "deny": ["convert_*"]},
+//	    {"name": "docs", "url": "https://docs.internal/mcp", "headers": {"Authorization": "Bearer ${DOCS_TOKEN}"}}
+//	  ]
+//	}
+//
+// Without "listen" the gateway is served over stdio. With "auth_token_env", HTTP clients must send
+// the token found in that environment variable as a bearer token.
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
+
+	fantasyextensions "github.com/arunsworld/fantasy-extensions"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type config struct {
+	Listen       string         `json:"listen"`
+	AuthTokenEnv string         `json:"auth_token_env"`
+	Separator    string         `json:"separator"`
+	Servers      []serverConfig `json:"servers"`
+}
+
+type serverConfig struct {
+	Name    string            `json:"name"`
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Allow   []string          `json:"allow"`
+	Deny    []string          `json:"deny"`
+	Timeout string            `json:"timeout"`
+}
+
+func run() error {
+	configPath := flag.String("config", "mcp-gateway.json", "path to the gateway config file")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "mcp-gateway", Version: "1.0.0"}, &mcp.ClientOptions{
+		ToolListChangedHandler:      fantasyextensions.MCPToolListChangedHandler,
+		ResourceListChangedHandler:  fantasyextensions.MCPResourceListChangedHandler,
+		PromptListChangedHandler:    fantasyextensions.MCPPromptListChangedHandler,
+		ProgressNotificationHandler: fantasyextensions.MCPProgressNotificationHandler,
+	})
+
+	var upstreams []fantasyextensions.MCPServer
+	for _, server := range cfg.Servers {
+		upstream, err := newUpstream(client, server)
+		if err != nil {
+			return err
+		}
+		defer upstream.Options.SessionPool.Close()
+		upstreams = append(upstreams, upstream)
+	}
+
+	gateway, err := fantasyextensions.NewMCPGateway(ctx, upstreams, fantasyextensions.MCPGatewayOptions{
+		Implementation: &mcp.Implementation{Name: "mcp-gateway", Version: "1.0.0"},
+		Separator:      cfg.Separator,
+	})
+	if err != nil {
+		return err
+	}
+	defer gateway.Close()
+
+	if cfg.Listen == "" {
+		return fantasyextensions.ServeMCPStdio(ctx, gateway.Server())
+	}
+	var handler http.Handler = fantasyextensions.MCPHTTPHandler(gateway.Server(), nil)
+	if cfg.AuthTokenEnv != "" {
+		token := os.Getenv(cfg.AuthTokenEnv)
+		if token == "" {
+			return fmt.Errorf("environment variable %s is not set", cfg.AuthTokenEnv)
+		}
+		handler = requireBearerToken(token, handler)
+	}
+	httpServer := &http.Server{Addr: cfg.Listen, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		_ = httpServer.Close()
+	}()
+	log.Printf("serving %d MCP servers on %s", len(upstreams), cfg.Listen)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func loadConfig(path string) (config, error) {
+	var cfg config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if len(cfg.Servers) == 0 {
+		return cfg, fmt.Errorf("invalid config %s: no servers", path)
+	}
+	return cfg, nil
+}
+
+func newUpstream(client *mcp.Client, server serverConfig) (fantasyextensions.MCPServer, error) {
+	if server.Name == "" {
+		return fantasyextensions.MCPServer{}, errors.New("every server needs a name")
+	}
+	var newTransport func() mcp.Transport
+	switch {
+	case server.Command != "" && server.URL != "":
+		return fantasyextensions.MCPServer{}, fmt.Errorf("server %s: set either command or url", server.Name)
+	case server.Command != "":
+		newTransport = func() mcp.Transport {
+			cmd := exec.Command(server.Command, server.Args...)
+			cmd.Env = os.Environ()
+			for name, value := range server.Env {
+				cmd.Env = append(cmd.Env, name+"="+os.ExpandEnv(value))
+			}
+			return &mcp.CommandTransport{Command: cmd}
+		}
+	case server.URL != "":
+		headers := http.Header{}
+		for name, value := range server.Headers {
+			headers.Set(name, os.ExpandEnv(value))
+		}
+		httpClient := &http.Client{Transport: &roundTripperWithHeaders{headers: headers, transport: http.DefaultTransport}}
+		newTransport = func() mcp.Transport {
+			return &mcp.StreamableClientTransport{Endpoint: server.URL, HTTPClient: httpClient}
+		}
+	default:
+		return fantasyextensions.MCPServer{}, fmt.Errorf("server %s: set either command or url", server.Name)
+	}
+
+	options := fantasyextensions.MCPToolsOptions{
+		Filter: fantasyextensions.MCPToolFilter{Allow: server.Allow, Deny: server.Deny},
+	}
+	if server.Timeout != "" {
+		timeout, err := time.ParseDuration(server.Timeout)
+		if err != nil {
+			return fantasyextensions.MCPServer{}, fmt.Errorf("server %s: invalid timeout: %w", server.Name, err)
+		}
+		options.Timeout = timeout
+	}
+	sessionMaker := func(ctx context.Context) (*mcp.ClientSession, error) {
+		return client.Connect(ctx, newTransport(), nil)
+	}
+	// keeps subprocesses running between calls
+	options.SessionPool = fantasyextensions.NewMCPSessionPool(sessionMaker, fantasyextensions.MCPSessionPoolOptions{})
+	return fantasyextensions.MCPServer{Name: server.Name, SessionMaker: sessionMaker, Options: options}, nil
+}
+
+type roundTripperWithHeaders struct {
+	headers   http.Header
+	transport http.RoundTripper
+}
+
+func (r *roundTripperWithHeaders) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range r.headers {
+		req.Header[name] = values
+	}
+	return r.transport.RoundTrip(req)
+}
+
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
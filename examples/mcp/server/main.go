@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"charm.land/fantasy"
+	fantasyextensions "github.com/arunsworld/fantasy-extensions"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type currentTimeInput struct {
+	Timezone string `json:"timezone" description:"IANA timezone name, e.g. Europe/London"`
+}
+
+func run() error {
+	addr := flag.String("http", "", "serve over streamable HTTP on this address instead of stdio")
+	flag.Parse()
+
+	currentTime := fantasy.NewAgentTool("get_current_time", "Get the current time in a timezone",
+		func(_ context.Context, input currentTimeInput, _ fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			location, err := time.LoadLocation(input.Timezone)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("unknown timezone %s", input.Timezone)), nil
+			}
+			return fantasy.NewTextResponse(time.Now().In(location).Format(time.RFC3339)), nil
+		})
+
+	server := fantasyextensions.NewMCPToolServer([]fantasy.AgentTool{currentTime}, fantasyextensions.MCPToolServerOptions{
+		Implementation: &mcp.Implementation{Name: "fantasy-time", Version: "1.0.0"},
+	})
+
+	if *addr != "" {
+		return http.ListenAndServe(*addr, fantasyextensions.MCPHTTPHandler(server, nil))
+	}
+	return fantasyextensions.ServeMCPStdio(context.Background(), server)
+}
@@ -3,73 +3,203 @@ package fantasyextensions
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
+	"time"
 
 	"charm.land/fantasy"
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 // Additional context like auth tokens may be passed in the context if desired.
 type MCPSessionMaker = func(context.Context) (*mcp.ClientSession, error)
 
+type MCPToolsOptions struct {
+	// SessionPool, when set, is used to obtain sessions instead of calling the session maker
+	// (and closing the session) for every tool call.
+	SessionPool *MCPSessionPool
+	// MaxTools caps the number of tools accepted from the server, after filtering. Tools beyond it,
+	// in the order the server lists them, are ignored. Zero means no limit.
+	MaxTools int
+	// MaxPages caps the number of tools/list pages fetched. Tools on further pages are ignored.
+	// Zero means no limit.
+	MaxPages int
+	// Media controls how image and audio content returned by tools is handled.
+	Media MCPMediaOptions
+	// ResolveResourceLinks reads resource links returned by tools (via resources/read on the
+	// same session) and includes their contents in the tool response.
+	ResolveResourceLinks bool
+	// Schema controls how tool input schemas are converted for the model provider.
+	Schema MCPSchemaOptions
+	// ArgumentValidation controls client-side validation of tool arguments against their input
+	// schema. Disabled by default.
+	ArgumentValidation MCPArgumentValidation
+	// Filter narrows the tools exposed from the server.
+	Filter MCPToolFilter
+	// Approval gates calls to destructive tools behind a human decision.
+	Approval MCPApprovalOptions
+	// Timeout bounds each tool call, including obtaining a session. Zero means no limit
+	// beyond the caller's context. When a call times out the server is asked to cancel it.
+	Timeout time.Duration
+	// ToolTimeouts overrides Timeout for individual tools, keyed by the tool's name on the server.
+	ToolTimeouts map[string]time.Duration
+	// Retry retries calls that fail transiently. Disabled by default.
+	Retry MCPRetryPolicy
+	// Cache reuses results of read-only tools called again with the same arguments. Disabled by default.
+	Cache MCPCacheOptions
+	// Output shortens oversized tool output before it reaches the model. Disabled by default.
+	Output MCPOutputPolicy
+}
+
+// ErrMCPToolsCursorLoop is returned when an MCP server hands back a tools/list cursor it has already returned.
+var ErrMCPToolsCursorLoop = errors.New("MCP server returned a looping tools/list cursor")
+
 func MCPTools(ctx context.Context, sessionMaker MCPSessionMaker) ([]fantasy.AgentTool, error) {
-	session, err := sessionMaker(ctx)
+	return MCPToolsWithOptions(ctx, sessionMaker, MCPToolsOptions{})
+}
+
+func MCPToolsWithOptions(ctx context.Context, sessionMaker MCPSessionMaker, options MCPToolsOptions) ([]fantasy.AgentTool, error) {
+	sessions := newMCPSessionProvider(sessionMaker, options)
+
+	var tools []*mcp.Tool
+	err := sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+		var err error
+		tools, err = listMCPTools(ctx, session, options)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create MCP session: %w", err)
+		return nil, err
 	}
-	defer session.Close()
+	return fantasyToolsFromMCPTools(tools, sessions, options)
+}
 
-	listToolsResult, err := session.ListTools(ctx, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error listing MCP tools: %w", err)
+func newMCPSessionProvider(sessionMaker MCPSessionMaker, options MCPToolsOptions) mcpSessionProvider {
+	if options.SessionPool != nil {
+		return options.SessionPool
 	}
-	tools := listToolsResult.Tools
+	return &mcpSessionMakerProvider{sessionMaker: sessionMaker}
+}
 
+func fantasyToolsFromMCPTools(tools []*mcp.Tool, sessions mcpSessionProvider, options MCPToolsOptions) ([]fantasy.AgentTool, error) {
 	result := make([]fantasy.AgentTool, 0, len(tools))
 	for _, tool := range tools {
-		toolInfo, err := toolInfoFromMCPTool(tool)
+		fantasyTool, err := newMCPFantasyTool(tool, sessions, options)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get tool info: %w", err)
+			return nil, err
 		}
-		result = append(result, &mcpFantasyTool{
-			toolInfo:     toolInfo,
-			sessionMaker: sessionMaker,
-		})
+		result = append(result, fantasyTool)
 	}
 	return result, nil
 }
 
-func toolInfoFromMCPTool(mcpTool *mcp.Tool) (fantasy.ToolInfo, error) {
-	toolName := mcpTool.Name
-	inputSchema, ok := mcpTool.InputSchema.(map[string]any)
-	if !ok {
-		return fantasy.ToolInfo{}, fmt.Errorf("error parsing MCP tool %s: input schema is not a map[string]any; instead got: %T", toolName, mcpTool.InputSchema)
-	}
-	properties, ok := inputSchema["properties"].(map[string]any)
-	if !ok {
-		return fantasy.ToolInfo{}, fmt.Errorf("error parsing MCP tool %s: properties is not a map[string]any; instead got: %T", toolName, inputSchema["properties"])
-	}
-	required := []string{}
-	if inputSchema["required"] != nil {
-		_required, ok := inputSchema["required"].([]any)
-		if !ok {
-			return fantasy.ToolInfo{}, fmt.Errorf("error parsing MCP tool %s: required is not a []string; instead got: %T", toolName, inputSchema["required"])
+func newMCPFantasyTool(tool *mcp.Tool, sessions mcpSessionProvider, options MCPToolsOptions) (*mcpFantasyTool, error) {
+	toolInfo, err := toolInfoFromMCPTool(tool, options.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool info: %w", err)
+	}
+	var outputSchema map[string]any
+	if schema, ok := tool.OutputSchema.(map[string]any); ok {
+		r := &mcpSchemaResolver{root: schema, resolving: map[string]bool{}}
+		outputSchema = r.resolveSchema(schema)
+	}
+	t := &mcpFantasyTool{
+		toolInfo:     toolInfo,
+		mcpName:      tool.Name,
+		mcpTool:      tool,
+		outputSchema: outputSchema,
+		sessions:     sessions,
+		options:      options,
+	}
+	// schemas the validator can't handle leave validation to the server
+	if options.ArgumentValidation != MCPArgumentValidationOff {
+		if t.inputValidator, err = resolveMCPValidationSchema(tool.InputSchema); err != nil {
+			log.Printf("not validating arguments of tool %s: %v", tool.Name, err)
+		}
+	}
+	if tool.OutputSchema != nil {
+		if t.outputValidator, err = resolveMCPValidationSchema(tool.OutputSchema); err != nil {
+			log.Printf("not validating output of tool %s: %v", tool.Name, err)
 		}
-		required = make([]string, 0, len(_required))
-		for _, r := range _required {
-			required = append(required, r.(string))
+	}
+	return t, nil
+}
+
+// listMCPTools walks tools/list pagination cursors until the server reports no further pages.
+func listMCPTools(ctx context.Context, session *mcp.ClientSession, options MCPToolsOptions) ([]*mcp.Tool, error) {
+	var tools []*mcp.Tool
+	params := &mcp.ListToolsParams{}
+	seenCursors := map[string]bool{}
+	for page := 1; ; page++ {
+		listToolsResult, err := session.ListTools(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("error listing MCP tools: %w", err)
+		}
+		for _, tool := range listToolsResult.Tools {
+			if options.Filter.keep(tool) {
+				tools = append(tools, tool)
+			}
 		}
+		if options.MaxTools > 0 && len(tools) >= options.MaxTools {
+			if len(tools) > options.MaxTools || listToolsResult.NextCursor != "" {
+				log.Printf("MCP server %s lists more than %d tools, ignoring the rest", mcpServerName(session), options.MaxTools)
+			}
+			return tools[:options.MaxTools], nil
+		}
+		cursor := listToolsResult.NextCursor
+		if cursor == "" {
+			return tools, nil
+		}
+		if options.MaxPages > 0 && page >= options.MaxPages {
+			log.Printf("MCP server %s lists more than %d pages of tools, ignoring the rest", mcpServerName(session), options.MaxPages)
+			return tools, nil
+		}
+		if seenCursors[cursor] {
+			return nil, fmt.Errorf("%w: %q", ErrMCPToolsCursorLoop, cursor)
+		}
+		seenCursors[cursor] = true
+		params.Cursor = cursor
+	}
+}
+
+func toolInfoFromMCPTool(mcpTool *mcp.Tool, options MCPSchemaOptions) (fantasy.ToolInfo, error) {
+	toolName := mcpTool.Name
+	schema, err := normalizeMCPInputSchema(mcpTool.InputSchema, options)
+	if err != nil {
+		return fantasy.ToolInfo{}, fmt.Errorf("error parsing MCP tool %s: %w", toolName, err)
+	}
+	description := mcpTool.Description
+	if description == "" {
+		description = schema.description
 	}
 	return fantasy.ToolInfo{
 		Name:        toolName,
-		Description: mcpTool.Description,
-		Parameters:  properties,
-		Required:    required,
+		Description: description,
+		Parameters:  schema.properties,
+		Required:    schema.required,
 	}, nil
 }
 
+// mcpSessionProvider runs fn against an MCP session, taking care of obtaining and disposing of it.
+type mcpSessionProvider interface {
+	withSession(ctx context.Context, fn func(*mcp.ClientSession) error) error
+}
+
+// mcpSessionMakerProvider creates a fresh session for every use and closes it afterwards.
+type mcpSessionMakerProvider struct {
+	sessionMaker MCPSessionMaker
+}
+
+func (p *mcpSessionMakerProvider) withSession(ctx context.Context, fn func(*mcp.ClientSession) error) error {
+	session, err := p.sessionMaker(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errMCPSessionCreation, err)
+	}
+	defer session.Close()
+	return fn(session)
+}
+
 type argWrapper struct {
 	jsonContent []byte
 }
@@ -78,54 +208,177 @@ func (w *argWrapper) MarshalJSON() ([]byte, error) {
 	return w.jsonContent, nil
 }
 
+// MCPAgentTool is implemented by the tools returned by MCPTools and friends.
+type MCPAgentTool interface {
+	fantasy.AgentTool
+	// OutputSchema returns the JSON schema of the tool's structured output, with $refs resolved,
+	// or nil if the tool doesn't declare one.
+	OutputSchema() map[string]any
+	// MCPTool returns the tool definition as published by the server.
+	MCPTool() *mcp.Tool
+	// Annotations returns the server's hints about the tool's behavior, or nil if it gave none.
+	Annotations() *mcp.ToolAnnotations
+}
+
+// MCPToolStructuredContentMetadataKey is the tool response metadata key under which structured
+// tool output is carried, so that UIs can render it against the tool's output schema. AGUIHandler
+// forwards it to the browser in a "tool_structured_content" event.
+const MCPToolStructuredContentMetadataKey = "structured_content"
+
 type mcpFantasyTool struct {
-	toolInfo        fantasy.ToolInfo
+	toolInfo fantasy.ToolInfo
+	// mcpName is the name of the tool on the MCP server, which may differ from toolInfo.Name
+	mcpName         string
+	mcpTool         *mcp.Tool
+	outputSchema    map[string]any
+	inputValidator  *jsonschema.Resolved
+	outputValidator *jsonschema.Resolved
 	providerOptions fantasy.ProviderOptions
-	sessionMaker    MCPSessionMaker
+	sessions        mcpSessionProvider
+	options         MCPToolsOptions
 }
 
 func (t *mcpFantasyTool) Info() fantasy.ToolInfo {
 	return t.toolInfo
 }
 
+func (t *mcpFantasyTool) OutputSchema() map[string]any {
+	return t.outputSchema
+}
+
+func (t *mcpFantasyTool) MCPTool() *mcp.Tool {
+	return t.mcpTool
+}
+
+func (t *mcpFantasyTool) Annotations() *mcp.ToolAnnotations {
+	if t.mcpTool == nil {
+		return nil
+	}
+	return t.mcpTool.Annotations
+}
+
 func (t *mcpFantasyTool) Run(ctx context.Context, params fantasy.ToolCall) (fantasy.ToolResponse, error) {
-	session, err := t.sessionMaker(ctx)
+	input, err := validateMCPArguments(params.Input, t.inputValidator, t.options.ArgumentValidation)
 	if err != nil {
-		return fantasy.NewTextErrorResponse(fmt.Sprintf("failed to create MCP session: %v", err)), nil
+		return mcpToolErrorResponse(&MCPToolError{
+			Kind:     MCPToolErrorInvalidArguments,
+			ToolName: t.mcpName,
+			Message:  fmt.Sprintf("invalid arguments for tool %s: %v", t.toolInfo.Name, err),
+			err:      err,
+		}), nil
+	}
+	cacheTTL := t.cacheTTL()
+	var cacheKey string
+	if cacheTTL > 0 {
+		// a cached result is served without calling the server, so it needs no approval
+		cacheKey = t.cacheKey(ctx, input)
+		if entry, ok := t.options.Cache.Store.Get(ctx, cacheKey); ok {
+			return withMCPResponseMetadata(entry.Response, MCPToolCacheMetadataKey, MCPCacheStatus{Hit: true, StoredAt: &entry.StoredAt}), nil
+		}
+	}
+	if toolErr := t.checkMCPApproval(ctx, params.ID, input); toolErr != nil {
+		return mcpToolErrorResponse(toolErr), nil
 	}
-	defer session.Close()
 
-	result, err := session.CallTool(ctx, &mcp.CallToolParams{
-		Name:      params.Name,
-		Arguments: &argWrapper{jsonContent: []byte(params.Input)},
+	callParams := &mcp.CallToolParams{
+		Name:      t.mcpName,
+		Arguments: &argWrapper{jsonContent: []byte(input)},
+	}
+	stopProgress := trackMCPProgress(ctx, callParams, params.ID, t.toolInfo.Name)
+	defer stopProgress()
+
+	callCtx := ctx
+	timeout := t.timeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var result *mcp.CallToolResult
+	var resolvedLinks map[string]*mcp.ReadResourceResult
+	// the SDK sends notifications/cancelled to the server when callCtx is done mid-call
+	attempts, err := t.callWithRetries(callCtx, func(attemptCtx context.Context) error {
+		return t.sessions.withSession(attemptCtx, func(session *mcp.ClientSession) error {
+			defer trackMCPSessionCall(attemptCtx, session, params.ID, t.toolInfo.Name)()
+			var err error
+			result, err = session.CallTool(attemptCtx, callParams)
+			if err != nil {
+				return wrapMCPHTTPStatus(attemptCtx, err)
+			}
+			if t.options.ResolveResourceLinks {
+				resolvedLinks = resolveMCPResourceLinks(attemptCtx, session, result.Content)
+			}
+			return nil
+		})
 	})
+	var response fantasy.ToolResponse
 	if err != nil {
-		return fantasy.NewTextErrorResponse(err.Error()), nil
+		toolErr := classifyMCPCallError(callCtx, t.mcpName, err)
+		if toolErr.Kind == MCPToolErrorTimeout && timeout > 0 && ctx.Err() == nil {
+			toolErr.Message = fmt.Sprintf("tool %s did not complete within %s and was cancelled; "+
+				"retry with a smaller request or try a different approach", t.toolInfo.Name, timeout)
+		}
+		response = mcpToolErrorResponse(toolErr)
+	} else {
+		response = t.applyOutputPolicy(ctx, input, t.response(result, resolvedLinks))
+		if cacheTTL > 0 && !response.IsError {
+			t.options.Cache.Store.Set(ctx, cacheKey, MCPCacheEntry{Response: response, StoredAt: time.Now()}, cacheTTL)
+		}
+	}
+	if t.options.Retry.enabled() {
+		response = withMCPResponseMetadata(response, MCPToolAttemptsMetadataKey, attempts)
+	}
+	if cacheTTL > 0 {
+		response = withMCPResponseMetadata(response, MCPToolCacheMetadataKey, MCPCacheStatus{})
+	}
+	return response, nil
+}
+
+// response converts the result of a successful call into a tool response.
+func (t *mcpFantasyTool) response(result *mcp.CallToolResult, resolvedLinks map[string]*mcp.ReadResourceResult) fantasy.ToolResponse {
+	if result.IsError {
+		output := &mcpToolOutput{mediaOptions: t.options.Media}
+		for _, content := range result.Content {
+			output.addContent(content, resolvedLinks)
+		}
+		return output.errorResponse(t.mcpName)
 	}
 
 	if result.StructuredContent != nil {
+		if t.outputValidator != nil {
+			if err := validateMCPStructuredContent(result.StructuredContent, t.outputValidator); err != nil {
+				return mcpToolErrorResponse(&MCPToolError{
+					Kind:     MCPToolErrorProtocol,
+					ToolName: t.mcpName,
+					Message:  fmt.Sprintf("output of tool %s does not match its output schema: %v", t.toolInfo.Name, err),
+					err:      err,
+				})
+			}
+		}
 		jsonResponse, err := json.Marshal(result.StructuredContent)
 		if err != nil {
-			return fantasy.NewTextErrorResponse(err.Error()), nil
+			return mcpToolErrorResponse(&MCPToolError{Kind: MCPToolErrorProtocol, ToolName: t.mcpName, Message: err.Error(), err: err})
 		}
-		return fantasy.ToolResponse{
-			Type:    "string",
-			Content: string(jsonResponse),
-		}, nil
+		return fantasy.WithResponseMetadata(fantasy.NewTextResponse(string(jsonResponse)), map[string]any{
+			MCPToolStructuredContentMetadataKey: result.StructuredContent,
+		})
 	}
 	if len(result.Content) == 0 {
-		return fantasy.NewTextErrorResponse("no content returned from tool"), nil
+		return mcpToolErrorResponse(&MCPToolError{Kind: MCPToolErrorProtocol, ToolName: t.mcpName, Message: "no content returned from tool"})
 	}
-	output := make([]string, 0, len(result.Content))
+	output := &mcpToolOutput{mediaOptions: t.options.Media}
 	for _, content := range result.Content {
-		textContent, ok := content.(*mcp.TextContent)
-		if !ok {
-			log.Printf("error casting content to text content: %T", content)
-			continue
-		}
-		output = append(output, textContent.Text)
+		output.addContent(content, resolvedLinks)
+	}
+	return output.response()
+}
+
+func (t *mcpFantasyTool) timeout() time.Duration {
+	if timeout, ok := t.options.ToolTimeouts[t.mcpName]; ok {
+		return timeout
 	}
-	return fantasy.NewTextResponse(strings.Join(output, "\n")), nil
+	return t.options.Timeout
 }
 
 func (t *mcpFantasyTool) ProviderOptions() fantasy.ProviderOptions {
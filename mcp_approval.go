@@ -0,0 +1,206 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ag-ui-protocol/ag-ui/sdks/community/go/pkg/core/events"
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCPApprovalRequest describes a tool call awaiting approval.
+type MCPApprovalRequest struct {
+	ToolCallID  string               `json:"tool_call_id"`
+	ToolName    string               `json:"tool_name"`
+	Input       string               `json:"input"`
+	Annotations *mcp.ToolAnnotations `json:"annotations,omitempty"`
+}
+
+type MCPApprovalDecision struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Approver decides whether a tool call may proceed.
+type Approver func(ctx context.Context, req MCPApprovalRequest) (MCPApprovalDecision, error)
+
+// AutoApprove approves every call.
+func AutoApprove(context.Context, MCPApprovalRequest) (MCPApprovalDecision, error) {
+	return MCPApprovalDecision{Approved: true}, nil
+}
+
+// DenyAll denies every call.
+func DenyAll(context.Context, MCPApprovalRequest) (MCPApprovalDecision, error) {
+	return MCPApprovalDecision{Approved: false, Reason: "calls to this tool are not allowed"}, nil
+}
+
+type MCPApprovalOptions struct {
+	// Approver decides calls to tools that require approval. If nil, no approval is required.
+	Approver Approver
+	// RequireApproval decides which tools require approval. Defaults to IsDestructiveMCPTool.
+	RequireApproval func(*mcp.Tool) bool
+}
+
+func (o MCPApprovalOptions) required(tool *mcp.Tool) bool {
+	if o.Approver == nil || tool == nil {
+		return false
+	}
+	if o.RequireApproval != nil {
+		return o.RequireApproval(tool)
+	}
+	return IsDestructiveMCPTool(tool)
+}
+
+// IsDestructiveMCPTool reports whether a tool may perform destructive updates according to its
+// annotations. Following the MCP defaults, tools without annotations are considered destructive.
+func IsDestructiveMCPTool(tool *mcp.Tool) bool {
+	annotations := tool.Annotations
+	if annotations == nil {
+		return true
+	}
+	if annotations.ReadOnlyHint {
+		return false
+	}
+	return annotations.DestructiveHint == nil || *annotations.DestructiveHint
+}
+
+// AGUIApprovalRequestEventName is the name of the AG-UI custom event asking the user to approve a tool call.
+const AGUIApprovalRequestEventName = "approval_request"
+
+const defaultAGUIApprovalTimeout = 5 * time.Minute
+
+type AGUIApproverOptions struct {
+	// Timeout bounds how long to wait for the user's decision before denying. Defaults to 5 minutes.
+	Timeout time.Duration
+	// Fallback decides calls made outside of an AGUIHandler run. If nil, such calls are denied.
+	Fallback Approver
+}
+
+// AGUIApprover asks the user to approve tool calls made within an AGUIHandler run. It emits an
+// AG-UI custom event named "approval_request" carrying an "approval_id" along with the
+// MCPApprovalRequest, and waits for the browser to post the decision to DecisionHandler.
+type AGUIApprover struct {
+	options AGUIApproverOptions
+
+	mu      sync.Mutex
+	pending map[string]chan MCPApprovalDecision
+}
+
+func NewAGUIApprover(options AGUIApproverOptions) *AGUIApprover {
+	if options.Timeout <= 0 {
+		options.Timeout = defaultAGUIApprovalTimeout
+	}
+	return &AGUIApprover{
+		options: options,
+		pending: make(map[string]chan MCPApprovalDecision),
+	}
+}
+
+// Approve implements Approver.
+func (a *AGUIApprover) Approve(ctx context.Context, req MCPApprovalRequest) (MCPApprovalDecision, error) {
+	run, ok := aguiRunFromContext(ctx)
+	if !ok {
+		if a.options.Fallback != nil {
+			return a.options.Fallback(ctx, req)
+		}
+		return MCPApprovalDecision{Approved: false, Reason: "no user available to approve the call"}, nil
+	}
+
+	approvalID := uuid.NewString()
+	decisions := make(chan MCPApprovalDecision, 1)
+	a.mu.Lock()
+	a.pending[approvalID] = decisions
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, approvalID)
+		a.mu.Unlock()
+	}()
+
+	event := events.NewCustomEvent(AGUIApprovalRequestEventName, events.WithValue(struct {
+		ApprovalID string `json:"approval_id"`
+		MCPApprovalRequest
+	}{ApprovalID: approvalID, MCPApprovalRequest: req}))
+	if err := run.emit(ctx, event); err != nil {
+		return MCPApprovalDecision{}, fmt.Errorf("failed to request approval: %w", err)
+	}
+
+	timer := time.NewTimer(a.options.Timeout)
+	defer timer.Stop()
+	select {
+	case decision := <-decisions:
+		return decision, nil
+	case <-timer.C:
+		return MCPApprovalDecision{Approved: false, Reason: "the user did not respond in time"}, nil
+	case <-ctx.Done():
+		return MCPApprovalDecision{}, ctx.Err()
+	}
+}
+
+// Decide delivers the user's decision for a pending approval.
+func (a *AGUIApprover) Decide(approvalID string, decision MCPApprovalDecision) error {
+	a.mu.Lock()
+	decisions, ok := a.pending[approvalID]
+	delete(a.pending, approvalID)
+	a.mu.Unlock()
+	if !ok {
+		return errors.New("no pending approval with this id")
+	}
+	decisions <- decision
+	return nil
+}
+
+// DecisionHandler accepts decisions posted by the browser as
+// {"approval_id": "...", "approved": true, "reason": "..."}.
+func (a *AGUIApprover) DecisionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			ApprovalID string `json:"approval_id"`
+			MCPApprovalDecision
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := a.Decide(input.ApprovalID, input.MCPApprovalDecision); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// checkMCPApproval returns the reason a call may not proceed, or nil if it may.
+func (t *mcpFantasyTool) checkMCPApproval(ctx context.Context, toolCallID, input string) *MCPToolError {
+	if !t.options.Approval.required(t.mcpTool) {
+		return nil
+	}
+	decision, err := t.options.Approval.Approver(ctx, MCPApprovalRequest{
+		ToolCallID:  toolCallID,
+		ToolName:    t.toolInfo.Name,
+		Input:       input,
+		Annotations: t.Annotations(),
+	})
+	if err != nil {
+		return &MCPToolError{
+			Kind:     MCPToolErrorDenied,
+			ToolName: t.mcpName,
+			Message:  fmt.Sprintf("approval for tool %s failed: %v", t.toolInfo.Name, err),
+			err:      err,
+		}
+	}
+	if decision.Approved {
+		return nil
+	}
+	message := fmt.Sprintf("the call to tool %s was not approved", t.toolInfo.Name)
+	if decision.Reason != "" {
+		message += ": " + decision.Reason
+	}
+	return &MCPToolError{Kind: MCPToolErrorDenied, ToolName: t.mcpName, Message: message}
+}
@@ -0,0 +1,220 @@
+package fantasyextensions
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newFileMCPServer(deletes *atomic.Int32) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "files", Version: "1.0.0"}, nil)
+	emptySchema := map[string]any{"type": "object"}
+	server.AddTool(&mcp.Tool{
+		Name:        "read_file",
+		InputSchema: emptySchema,
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "contents"}}}, nil
+	})
+	server.AddTool(&mcp.Tool{Name: "delete_file", InputSchema: emptySchema}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		deletes.Add(1)
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "deleted"}}}, nil
+	})
+	return server
+}
+
+func mcpToolsByName(t *testing.T, sessionMaker MCPSessionMaker, options MCPToolsOptions) map[string]fantasy.AgentTool {
+	t.Helper()
+	tools, err := MCPToolsWithOptions(context.Background(), sessionMaker, options)
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	toolsByName := map[string]fantasy.AgentTool{}
+	for _, tool := range tools {
+		toolsByName[tool.Info().Name] = tool
+	}
+	return toolsByName
+}
+
+func TestIsDestructiveMCPTool(t *testing.T) {
+	t.Parallel()
+	no, yes := false, true
+	tests := []struct {
+		name        string
+		annotations *mcp.ToolAnnotations
+		expected    bool
+	}{
+		{name: "no annotations", expected: true},
+		{name: "read only", annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}, expected: false},
+		{name: "destructive hint unset", annotations: &mcp.ToolAnnotations{}, expected: true},
+		{name: "not destructive", annotations: &mcp.ToolAnnotations{DestructiveHint: &no}, expected: false},
+		{name: "destructive", annotations: &mcp.ToolAnnotations{DestructiveHint: &yes}, expected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := IsDestructiveMCPTool(&mcp.Tool{Annotations: tt.annotations}); got != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMCPTools_Approval(t *testing.T) {
+	t.Parallel()
+	failingApprover := func(context.Context, MCPApprovalRequest) (MCPApprovalDecision, error) {
+		return MCPApprovalDecision{}, errors.New("approval service unavailable")
+	}
+	tests := []struct {
+		name            string
+		approver        Approver
+		tool            string
+		expectedDenied  bool
+		expectedDeletes int32
+	}{
+		{name: "deny blocks destructive tool", approver: DenyAll, tool: "delete_file", expectedDenied: true},
+		{name: "approver errors deny", approver: failingApprover, tool: "delete_file", expectedDenied: true},
+		{name: "auto approve", approver: AutoApprove, tool: "delete_file", expectedDeletes: 1},
+		{name: "no approver", tool: "delete_file", expectedDeletes: 1},
+		{name: "read only tools skip approval", approver: DenyAll, tool: "read_file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			var deletes atomic.Int32
+			sessionMaker, _ := newTestMCPSessionMaker(t, newFileMCPServer(&deletes), nil)
+			tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{Approval: MCPApprovalOptions{Approver: tt.approver}})
+
+			// When
+			resp, err := tools[tt.tool].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: tt.tool, Input: "{}"})
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if denied := errors.Is(MCPToolResponseError(resp), ErrMCPDenied); denied != tt.expectedDenied {
+				t.Fatalf("expected denied %v, got %v: %s", tt.expectedDenied, denied, resp.Content)
+			}
+			if got := deletes.Load(); got != tt.expectedDeletes {
+				t.Fatalf("expected %d deletes, got %d", tt.expectedDeletes, got)
+			}
+		})
+	}
+}
+
+func TestAGUIApprover_RoundTrip(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name            string
+		approved        bool
+		expectedDeletes int32
+	}{
+		{name: "approved", approved: true, expectedDeletes: 1},
+		{name: "rejected", approved: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			var deletes atomic.Int32
+			sessionMaker, _ := newTestMCPSessionMaker(t, newFileMCPServer(&deletes), nil)
+			approver := NewAGUIApprover(AGUIApproverOptions{Timeout: 5 * time.Second})
+			tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{Approval: MCPApprovalOptions{Approver: approver.Approve}})
+			decisionServer := httptest.NewServer(approver.DecisionHandler())
+			t.Cleanup(decisionServer.Close)
+
+			events, stream := io.Pipe()
+			t.Cleanup(func() { _ = events.Close() })
+			recorder := &pipeResponseWriter{header: http.Header{}, w: stream}
+			ctx := context.WithValue(context.Background(), aguiRunContextKey{}, &aguiRun{
+				threadID: "thread-1",
+				runID:    "run-1",
+				writer:   newStreamWriter(recorder),
+			})
+
+			// the browser: wait for the approval request and post the decision
+			go func() {
+				scanner := bufio.NewScanner(events)
+				for scanner.Scan() {
+					data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+					if !ok {
+						continue
+					}
+					var event struct {
+						Name  string `json:"name"`
+						Value struct {
+							ApprovalID string `json:"approval_id"`
+							ToolCallID string `json:"tool_call_id"`
+						} `json:"value"`
+					}
+					if err := json.Unmarshal([]byte(data), &event); err != nil || event.Name != AGUIApprovalRequestEventName || event.Value.ToolCallID != "call-1" {
+						continue
+					}
+					body, _ := json.Marshal(map[string]any{"approval_id": event.Value.ApprovalID, "approved": tt.approved, "reason": "user said so"})
+					resp, err := http.Post(decisionServer.URL, "application/json", strings.NewReader(string(body)))
+					if err == nil {
+						_ = resp.Body.Close()
+					}
+					return
+				}
+			}()
+
+			// When
+			resp, err := tools["delete_file"].Run(ctx, fantasy.ToolCall{ID: "call-1", Name: "delete_file", Input: "{}"})
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if denied := errors.Is(MCPToolResponseError(resp), ErrMCPDenied); denied == tt.approved {
+				t.Fatalf("expected denied %v, got %v: %s", !tt.approved, denied, resp.Content)
+			}
+			if !tt.approved && !strings.Contains(resp.Content, "user said so") {
+				t.Fatalf("expected the reason in the response, got %q", resp.Content)
+			}
+			if got := deletes.Load(); got != tt.expectedDeletes {
+				t.Fatalf("expected %d deletes, got %d", tt.expectedDeletes, got)
+			}
+		})
+	}
+}
+
+func TestAGUIApprover_Fallback(t *testing.T) {
+	t.Parallel()
+	// Given
+	approver := NewAGUIApprover(AGUIApproverOptions{Fallback: AutoApprove})
+
+	// When
+	decision, err := approver.Approve(context.Background(), MCPApprovalRequest{ToolName: "delete_file"})
+
+	// Then
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !decision.Approved {
+		t.Fatalf("expected the fallback to approve outside of an AG-UI run")
+	}
+}
+
+// pipeResponseWriter streams what is written to it, so that tests can react to events as they are sent.
+type pipeResponseWriter struct {
+	header http.Header
+	w      io.Writer
+}
+
+func (p *pipeResponseWriter) Header() http.Header         { return p.header }
+func (p *pipeResponseWriter) Write(b []byte) (int, error) { return p.w.Write(b) }
+func (p *pipeResponseWriter) WriteHeader(int)             {}
+func (p *pipeResponseWriter) Flush()                      {}
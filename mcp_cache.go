@@ -0,0 +1,202 @@
+package fantasyextensions
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"charm.land/fantasy"
+)
+
+// MCPToolCacheMetadataKey is the tool response metadata key under which an MCPCacheStatus is
+// recorded for calls to cached tools.
+const MCPToolCacheMetadataKey = "cache"
+
+const (
+	defaultMCPCacheTTL        = 5 * time.Minute
+	defaultMCPCacheMaxEntries = 1000
+)
+
+// MCPCacheOptions reuses the results of tool calls repeated with the same arguments, saving a
+// round trip to the server. Caching is disabled unless Store is set.
+//
+// Tools annotated as read-only are cached; others only if listed in ToolTTLs. Only successful
+// results are cached.
+type MCPCacheOptions struct {
+	// Store holds cached results. NewMCPMemoryCacheStore keeps them in memory; a store may be
+	// shared between tools of several servers as long as their names don't collide.
+	Store MCPCacheStore
+	// TTL is how long results are reused. Defaults to 5 minutes.
+	TTL time.Duration
+	// ToolTTLs enables caching for individual tools, keyed by the tool's name on the server,
+	// overriding TTL unless zero. A negative value disables caching of the tool, even if read-only.
+	ToolTTLs map[string]time.Duration
+	// KeyFunc derives an identity (e.g. the user behind an auth token) from the context. Results
+	// are only reused for callers with the same key. If nil, all callers share results.
+	KeyFunc func(context.Context) string
+}
+
+// MCPCacheStore holds cached tool results by key. Implementations must be safe for concurrent use.
+type MCPCacheStore interface {
+	// Get returns the entry stored under key, unless it has expired.
+	Get(ctx context.Context, key string) (MCPCacheEntry, bool)
+	// Set stores entry under key, to expire after ttl.
+	Set(ctx context.Context, key string, entry MCPCacheEntry, ttl time.Duration)
+}
+
+// MCPCacheEntry is a cached tool result.
+type MCPCacheEntry struct {
+	Response fantasy.ToolResponse `json:"response"`
+	StoredAt time.Time            `json:"stored_at"`
+}
+
+// MCPCacheStatus tells whether a response was served from the cache, and if so since when it was
+// cached.
+type MCPCacheStatus struct {
+	Hit      bool       `json:"hit"`
+	StoredAt *time.Time `json:"stored_at,omitempty"`
+}
+
+// cacheTTL returns how long results of t are cached, or zero if they aren't.
+func (t *mcpFantasyTool) cacheTTL() time.Duration {
+	options := t.options.Cache
+	if options.Store == nil {
+		return 0
+	}
+	ttl := options.TTL
+	if ttl <= 0 {
+		ttl = defaultMCPCacheTTL
+	}
+	if toolTTL, ok := options.ToolTTLs[t.mcpName]; ok {
+		switch {
+		case toolTTL < 0:
+			return 0
+		case toolTTL > 0:
+			return toolTTL
+		}
+		return ttl
+	}
+	if annotations := t.Annotations(); annotations != nil && annotations.ReadOnlyHint {
+		return ttl
+	}
+	return 0
+}
+
+// cacheKey identifies a call by the tool's name, its arguments in canonical form and the caller's
+// identity. Keys are hashed so that stores needn't worry about their length or characters.
+func (t *mcpFantasyTool) cacheKey(ctx context.Context, input string) string {
+	identity := ""
+	if t.options.Cache.KeyFunc != nil {
+		identity = t.options.Cache.KeyFunc(ctx)
+	}
+	hash := sha256.New()
+	for _, part := range []string{t.toolInfo.Name, canonicalMCPArguments(input), identity} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// canonicalMCPArguments re-encodes JSON arguments with sorted keys and no insignificant
+// whitespace, so that equivalent arguments share cache entries.
+func canonicalMCPArguments(input string) string {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(input)))
+	decoder.UseNumber()
+	var arguments any
+	if err := decoder.Decode(&arguments); err != nil {
+		return input
+	}
+	canonical, err := json.Marshal(arguments)
+	if err != nil {
+		return input
+	}
+	return string(canonical)
+}
+
+type MCPMemoryCacheStoreOptions struct {
+	// MaxEntries caps the number of cached results. Defaults to 1000.
+	MaxEntries int
+	// MaxBytes caps the total size of cached responses. Zero means no limit.
+	MaxBytes int
+}
+
+// MCPMemoryCacheStore is an MCPCacheStore keeping results in memory, evicting the least recently
+// used results when full.
+type MCPMemoryCacheStore struct {
+	options MCPMemoryCacheStoreOptions
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	bytes   int
+}
+
+type mcpMemoryCacheItem struct {
+	key       string
+	entry     MCPCacheEntry
+	expiresAt time.Time
+	size      int
+}
+
+func NewMCPMemoryCacheStore(options MCPMemoryCacheStoreOptions) *MCPMemoryCacheStore {
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = defaultMCPCacheMaxEntries
+	}
+	return &MCPMemoryCacheStore{options: options, entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+func (s *MCPMemoryCacheStore) Get(_ context.Context, key string) (MCPCacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return MCPCacheEntry{}, false
+	}
+	item := element.Value.(*mcpMemoryCacheItem)
+	if time.Now().After(item.expiresAt) {
+		s.remove(element)
+		return MCPCacheEntry{}, false
+	}
+	s.lru.MoveToFront(element)
+	return item.entry, true
+}
+
+func (s *MCPMemoryCacheStore) Set(_ context.Context, key string, entry MCPCacheEntry, ttl time.Duration) {
+	item := &mcpMemoryCacheItem{
+		key:       key,
+		entry:     entry,
+		expiresAt: time.Now().Add(ttl),
+		size:      len(entry.Response.Content) + len(entry.Response.Metadata),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.entries[key]; ok {
+		s.remove(element)
+	}
+	if s.options.MaxBytes > 0 && item.size > s.options.MaxBytes {
+		return
+	}
+	s.entries[key] = s.lru.PushFront(item)
+	s.bytes += item.size
+	for s.lru.Len() > s.options.MaxEntries || (s.options.MaxBytes > 0 && s.bytes > s.options.MaxBytes) {
+		s.remove(s.lru.Back())
+	}
+}
+
+// Len returns the number of cached results, including expired ones not yet evicted.
+func (s *MCPMemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+func (s *MCPMemoryCacheStore) remove(element *list.Element) {
+	item := s.lru.Remove(element).(*mcpMemoryCacheItem)
+	delete(s.entries, item.key)
+	s.bytes -= item.size
+}
@@ -0,0 +1,183 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type libraryInput struct {
+	LibraryName string `json:"libraryName"`
+	Version     string `json:"version,omitempty"`
+}
+
+// newLibraryMCPServer returns a server counting calls to its read-only "resolve-library-id" tool,
+// its "star-library" tool and its read-only "search" tool, which fails.
+func newLibraryMCPServer(calls *atomic.Int32) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "libraries", Version: "1.0.0"}, nil)
+	readOnly := &mcp.ToolAnnotations{ReadOnlyHint: true}
+	mcp.AddTool(server, &mcp.Tool{Name: "resolve-library-id", Annotations: readOnly}, func(_ context.Context, _ *mcp.CallToolRequest, input libraryInput) (*mcp.CallToolResult, any, error) {
+		n := calls.Add(1)
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("/libs/%s#%d", strings.ToLower(input.LibraryName), n)}}}, nil, nil
+	})
+	mcp.AddTool(server, &mcp.Tool{Name: "star-library"}, func(_ context.Context, _ *mcp.CallToolRequest, _ libraryInput) (*mcp.CallToolResult, any, error) {
+		calls.Add(1)
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "starred"}}}, nil, nil
+	})
+	mcp.AddTool(server, &mcp.Tool{Name: "search", Annotations: readOnly}, func(_ context.Context, _ *mcp.CallToolRequest, _ libraryInput) (*mcp.CallToolResult, any, error) {
+		calls.Add(1)
+		return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: "index unavailable"}}}, nil, nil
+	})
+	return server
+}
+
+func mcpToolCacheStatus(t *testing.T, resp fantasy.ToolResponse) *MCPCacheStatus {
+	t.Helper()
+	var metadata struct {
+		Cache *MCPCacheStatus `json:"cache"`
+	}
+	if resp.Metadata == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(resp.Metadata), &metadata); err != nil {
+		t.Fatalf("failed to decode metadata %q: %v", resp.Metadata, err)
+	}
+	return metadata.Cache
+}
+
+type identityContextKey struct{}
+
+func TestMCPTools_CachesResults(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		tool          string
+		cache         MCPCacheOptions
+		secondInput   string
+		secondUser    string
+		expectedCalls int32
+	}{
+		{name: "read only tool", tool: "resolve-library-id", secondInput: `{ "version": "15", "libraryName": "Next.js" }`, expectedCalls: 1},
+		{name: "different arguments", tool: "resolve-library-id", secondInput: `{"libraryName": "React"}`, expectedCalls: 2},
+		{name: "other tools are not cached", tool: "star-library", expectedCalls: 2},
+		{name: "other tools cached when listed", tool: "star-library", cache: MCPCacheOptions{ToolTTLs: map[string]time.Duration{"star-library": 0}}, expectedCalls: 1},
+		{name: "read only tool disabled", tool: "resolve-library-id", cache: MCPCacheOptions{ToolTTLs: map[string]time.Duration{"resolve-library-id": -1}}, expectedCalls: 2},
+		{name: "errors are not cached", tool: "search", expectedCalls: 2},
+		{name: "same identity", tool: "resolve-library-id", secondUser: "alice", expectedCalls: 1},
+		{name: "different identity", tool: "resolve-library-id", secondUser: "bob", expectedCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			var calls atomic.Int32
+			sessionMaker, _ := newTestMCPSessionMaker(t, newLibraryMCPServer(&calls), nil)
+			cache := tt.cache
+			cache.Store = NewMCPMemoryCacheStore(MCPMemoryCacheStoreOptions{})
+			cache.KeyFunc = func(ctx context.Context) string {
+				user, _ := ctx.Value(identityContextKey{}).(string)
+				return user
+			}
+			tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{Cache: cache})
+			firstInput := `{"libraryName": "Next.js", "version": "15"}`
+			secondInput := tt.secondInput
+			if secondInput == "" {
+				secondInput = firstInput
+			}
+			secondUser := tt.secondUser
+			if secondUser == "" {
+				secondUser = "alice"
+			}
+			aliceCtx := context.WithValue(context.Background(), identityContextKey{}, "alice")
+			secondCtx := context.WithValue(context.Background(), identityContextKey{}, secondUser)
+
+			// When
+			first, err := tools[tt.tool].Run(aliceCtx, fantasy.ToolCall{ID: "call-1", Name: tt.tool, Input: firstInput})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			second, err := tools[tt.tool].Run(secondCtx, fantasy.ToolCall{ID: "call-2", Name: tt.tool, Input: secondInput})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Then
+			if got := calls.Load(); got != tt.expectedCalls {
+				t.Fatalf("expected %d calls to the server, got %d", tt.expectedCalls, got)
+			}
+			if tt.expectedCalls == 1 {
+				if second.Content != first.Content {
+					t.Fatalf("expected the cached content %q, got %q", first.Content, second.Content)
+				}
+				if status := mcpToolCacheStatus(t, second); status == nil || !status.Hit || status.StoredAt == nil {
+					t.Fatalf("expected a cache hit, got %+v", status)
+				}
+				if status := mcpToolCacheStatus(t, first); status == nil || status.Hit {
+					t.Fatalf("expected a cache miss on the first call, got %+v", status)
+				}
+			} else if status := mcpToolCacheStatus(t, second); status != nil && status.Hit {
+				t.Fatalf("expected no cache hit, got %+v", status)
+			}
+		})
+	}
+}
+
+func TestMCPMemoryCacheStore(t *testing.T) {
+	t.Parallel()
+	entry := func(content string) MCPCacheEntry {
+		return MCPCacheEntry{Response: fantasy.NewTextResponse(content), StoredAt: time.Now()}
+	}
+	tests := []struct {
+		name         string
+		options      MCPMemoryCacheStoreOptions
+		ttl          time.Duration
+		sets         []string
+		gets         []string
+		expectedKeys []string
+	}{
+		{name: "keeps entries", ttl: time.Minute, sets: []string{"a", "b"}, expectedKeys: []string{"a", "b"}},
+		{name: "expires entries", ttl: -time.Second, sets: []string{"a"}, expectedKeys: nil},
+		{name: "evicts least recently used", options: MCPMemoryCacheStoreOptions{MaxEntries: 2}, ttl: time.Minute,
+			sets: []string{"a", "b"}, gets: []string{"a"}, expectedKeys: []string{"a"}},
+		{name: "bounds size", options: MCPMemoryCacheStoreOptions{MaxBytes: 15}, ttl: time.Minute,
+			sets: []string{"a", "b"}, expectedKeys: []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			ctx := context.Background()
+			store := NewMCPMemoryCacheStore(tt.options)
+			for _, key := range tt.sets {
+				store.Set(ctx, key, entry("value-"+key), tt.ttl)
+			}
+			for _, key := range tt.gets {
+				store.Get(ctx, key)
+			}
+
+			// When
+			store.Set(ctx, "c", entry("value-c"), tt.ttl)
+
+			// Then
+			var keys []string
+			for _, key := range tt.sets {
+				if got, ok := store.Get(ctx, key); ok {
+					if got.Response.Content != "value-"+key {
+						t.Fatalf("unexpected value for %s: %q", key, got.Response.Content)
+					}
+					keys = append(keys, key)
+				}
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.expectedKeys, ",") {
+				t.Fatalf("expected %v to remain cached, got %v", tt.expectedKeys, keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// mcpToolOutput accumulates MCP content blocks into a fantasy tool response.
+type mcpToolOutput struct {
+	mediaOptions MCPMediaOptions
+	text         []string
+	media        []MCPToolMedia
+}
+
+func (o *mcpToolOutput) addContent(content mcp.Content, resolvedLinks map[string]*mcp.ReadResourceResult) {
+	switch c := content.(type) {
+	case *mcp.TextContent:
+		o.text = append(o.text, c.Text)
+	case *mcp.ImageContent:
+		o.addMedia("image", c.MIMEType, c.Data)
+	case *mcp.AudioContent:
+		o.addMedia("audio", c.MIMEType, c.Data)
+	case *mcp.EmbeddedResource:
+		if c.Resource != nil {
+			o.addResource(c.Resource)
+		}
+	case *mcp.ResourceLink:
+		resolved, ok := resolvedLinks[c.URI]
+		if !ok {
+			o.text = append(o.text, formatMCPResourceLink(c))
+			return
+		}
+		for _, contents := range resolved.Contents {
+			o.addResource(contents)
+		}
+	default:
+		log.Printf("unsupported MCP content type: %T", content)
+	}
+}
+
+func (o *mcpToolOutput) addMedia(kind, mediaType string, data []byte) {
+	media, text, ok := mcpToolMedia(kind, mediaType, data, o.mediaOptions)
+	if ok {
+		o.media = append(o.media, media)
+	}
+	o.text = append(o.text, text)
+}
+
+// addResource renders text resources inline and converts blob resources to media.
+func (o *mcpToolOutput) addResource(contents *mcp.ResourceContents) {
+	if contents.Blob != nil {
+		kind := "resource"
+		switch {
+		case strings.HasPrefix(contents.MIMEType, "image/"):
+			kind = "image"
+		case strings.HasPrefix(contents.MIMEType, "audio/"):
+			kind = "audio"
+		}
+		o.text = append(o.text, fmt.Sprintf("[resource: %s]", contents.URI))
+		o.addMedia(kind, contents.MIMEType, contents.Blob)
+		return
+	}
+	header := "[resource: " + contents.URI
+	if contents.MIMEType != "" {
+		header += " (" + contents.MIMEType + ")"
+	}
+	o.text = append(o.text, header+"]\n"+contents.Text)
+}
+
+func (o *mcpToolOutput) response() fantasy.ToolResponse {
+	return fantasy.WithResponseMetadata(fantasy.NewTextResponse(strings.Join(o.text, "\n")), o.metadata())
+}
+
+// errorResponse reports the output of a tool that signalled a failure, preserving the server's text.
+func (o *mcpToolOutput) errorResponse(toolName string) fantasy.ToolResponse {
+	message := strings.Join(o.text, "\n")
+	if message == "" {
+		message = "tool reported an error without details"
+	}
+	metadata := o.metadata()
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	metadata[MCPToolErrorMetadataKey] = &MCPToolError{Kind: MCPToolErrorTool, ToolName: toolName, Message: message}
+	return fantasy.WithResponseMetadata(fantasy.NewTextErrorResponse(message), metadata)
+}
+
+func (o *mcpToolOutput) metadata() map[string]any {
+	if len(o.media) == 0 {
+		return nil
+	}
+	return map[string]any{MCPToolMediaMetadataKey: o.media}
+}
+
+// withMCPResponseMetadata adds key to the metadata already recorded on response.
+func withMCPResponseMetadata(response fantasy.ToolResponse, key string, value any) fantasy.ToolResponse {
+	var metadata map[string]json.RawMessage
+	if response.Metadata != "" {
+		if err := json.Unmarshal([]byte(response.Metadata), &metadata); err != nil {
+			log.Printf("failed to decode tool response metadata: %v", err)
+			return response
+		}
+	}
+	if metadata == nil {
+		// metadata may be absent or "null"
+		metadata = map[string]json.RawMessage{}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("failed to encode tool response metadata %s: %v", key, err)
+		return response
+	}
+	metadata[key] = encoded
+	return fantasy.WithResponseMetadata(response, metadata)
+}
+
+func formatMCPResourceLink(link *mcp.ResourceLink) string {
+	parts := []string{link.URI}
+	if link.Name != "" {
+		parts = append(parts, "name: "+link.Name)
+	}
+	if link.MIMEType != "" {
+		parts = append(parts, "type: "+link.MIMEType)
+	}
+	if link.Description != "" {
+		parts = append(parts, "description: "+link.Description)
+	}
+	return "[resource link: " + strings.Join(parts, ", ") + "]"
+}
+
+// resolveMCPResourceLinks reads every resource link in contents. Links that can't be read are
+// left out, so they are rendered as links.
+func resolveMCPResourceLinks(ctx context.Context, session *mcp.ClientSession, contents []mcp.Content) map[string]*mcp.ReadResourceResult {
+	resolved := map[string]*mcp.ReadResourceResult{}
+	for _, content := range contents {
+		link, ok := content.(*mcp.ResourceLink)
+		if !ok {
+			continue
+		}
+		if _, ok := resolved[link.URI]; ok {
+			continue
+		}
+		result, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: link.URI})
+		if err != nil {
+			log.Printf("error reading MCP resource %s: %v", link.URI, err)
+			continue
+		}
+		resolved[link.URI] = result
+	}
+	return resolved
+}
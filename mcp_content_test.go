@@ -0,0 +1,69 @@
+package fantasyextensions
+
+import (
+	"context"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newDocsMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "docs", Version: "1.0.0"}, nil)
+	server.AddResource(&mcp.Resource{URI: "docs://guide", Name: "guide", MIMEType: "text/markdown"}, func(context.Context, *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{
+			{URI: "docs://guide", MIMEType: "text/markdown", Text: "# Guide"},
+		}}, nil
+	})
+	server.AddTool(&mcp.Tool{Name: "fetch_docs", InputSchema: map[string]any{"type": "object", "properties": map[string]any{}}}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{
+			&mcp.EmbeddedResource{Resource: &mcp.ResourceContents{URI: "docs://readme", MIMEType: "text/plain", Text: "hello"}},
+			&mcp.EmbeddedResource{Resource: &mcp.ResourceContents{URI: "docs://logo", MIMEType: "image/png", Blob: []byte("png")}},
+			&mcp.ResourceLink{URI: "docs://guide", Name: "guide", MIMEType: "text/markdown"},
+		}}, nil
+	})
+	return server
+}
+
+func TestMCPTools_RendersResources(t *testing.T) {
+	t.Parallel()
+	sessionMaker, _ := newTestMCPSessionMaker(t, newDocsMCPServer(), nil)
+	tests := []struct {
+		name            string
+		resolveLinks    bool
+		expectedContent string
+	}{
+		{
+			name:            "links as references",
+			expectedContent: "[resource: docs://readme (text/plain)]\nhello\n[resource: docs://logo]\n[image: image/png, 3 bytes]\n[resource link: docs://guide, name: guide, type: text/markdown]",
+		},
+		{
+			name:            "links resolved",
+			resolveLinks:    true,
+			expectedContent: "[resource: docs://readme (text/plain)]\nhello\n[resource: docs://logo]\n[image: image/png, 3 bytes]\n[resource: docs://guide (text/markdown)]\n# Guide",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			tools, err := MCPToolsWithOptions(context.Background(), sessionMaker, MCPToolsOptions{ResolveResourceLinks: tt.resolveLinks})
+			if err != nil {
+				t.Fatalf("failed to list tools: %v", err)
+			}
+
+			// When
+			resp, err := tools[0].Run(context.Background(), fantasy.ToolCall{Name: "fetch_docs", Input: `{}`})
+
+			// Then
+			if err != nil || resp.IsError {
+				t.Fatalf("unexpected response: %+v, %v", resp, err)
+			}
+			if resp.Content != tt.expectedContent {
+				t.Fatalf("unexpected content:\n%s", resp.Content)
+			}
+			if resp.Metadata == "" {
+				t.Fatalf("expected blob resource in metadata")
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package fantasyextensions
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ag-ui-protocol/ag-ui/sdks/community/go/pkg/core/events"
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Actions a user may take in response to an elicitation request.
+const (
+	MCPElicitationAccept  = "accept"
+	MCPElicitationDecline = "decline"
+	MCPElicitationCancel  = "cancel"
+)
+
+// MCPElicitationRequest describes a server's request for input from the user.
+type MCPElicitationRequest struct {
+	// ToolCallID and ToolName identify the tool call during which the server asked, if any.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	ToolName   string `json:"tool_name,omitempty"`
+	Message    string `json:"message"`
+	// RequestedSchema is a JSON schema of an object with top level properties of primitive types.
+	RequestedSchema any `json:"requested_schema"`
+}
+
+// MCPElicitationResponse is the user's answer to an elicitation request. Content is only sent to the
+// server when the action is MCPElicitationAccept.
+type MCPElicitationResponse struct {
+	Action  string         `json:"action"`
+	Content map[string]any `json:"content,omitempty"`
+}
+
+// Elicitor asks the user for the input requested by an MCP server.
+type Elicitor func(ctx context.Context, req MCPElicitationRequest) (MCPElicitationResponse, error)
+
+// DeclineElicitation declines every request.
+func DeclineElicitation(context.Context, MCPElicitationRequest) (MCPElicitationResponse, error) {
+	return MCPElicitationResponse{Action: MCPElicitationDecline}, nil
+}
+
+// NewMCPElicitationHandler returns a handler serving elicitation/create requests from MCP servers
+// with elicitor. Use it as mcp.ClientOptions.ElicitationHandler:
+//
+//	client := mcp.NewClient(impl, &mcp.ClientOptions{
+//		ElicitationHandler: fantasyextensions.NewMCPElicitationHandler(elicitor.Elicit),
+//	})
+//
+// Requests made by a server while it handles a tool call are passed to elicitor with the context
+// of the call, so that an AGUIElicitor can reach the user of the run the call belongs to.
+func NewMCPElicitationHandler(elicitor Elicitor) func(context.Context, *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+	return func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+		if req.Params == nil {
+			return nil, errors.New("missing elicitation parameters")
+		}
+		request := MCPElicitationRequest{Message: req.Params.Message, RequestedSchema: req.Params.RequestedSchema}
+		ctx, call, cancel := withMCPSessionCallContext(ctx, req.Session)
+		defer cancel()
+		if call != nil {
+			request.ToolCallID = call.toolCallID
+			request.ToolName = call.toolName
+		}
+		response, err := elicitor(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		switch response.Action {
+		case MCPElicitationAccept:
+			return &mcp.ElicitResult{Action: response.Action, Content: response.Content}, nil
+		case MCPElicitationDecline, MCPElicitationCancel:
+			return &mcp.ElicitResult{Action: response.Action}, nil
+		default:
+			return nil, fmt.Errorf("unknown elicitation action %q", response.Action)
+		}
+	}
+}
+
+// mcpSessionCall is the tool call a session is currently serving.
+type mcpSessionCall struct {
+	ctx        context.Context
+	toolCallID string
+	toolName   string
+}
+
+var (
+	mcpSessionCallsMu sync.Mutex
+	mcpSessionCalls   = map[*mcp.ClientSession]*mcpSessionCall{}
+)
+
+// mcpSessionCallGracePeriod is how long a session stays tied to a completed call. The SDK hands
+// notifications to their handlers asynchronously, so those sent during a call may be handled after
+// the call returns.
+const mcpSessionCallGracePeriod = time.Second
+
+// trackMCPSessionCall records that session is serving a tool call, so that requests and
+// notifications the server sends in the meantime can be tied to it. The returned func must be
+// called once the call completes.
+func trackMCPSessionCall(ctx context.Context, session *mcp.ClientSession, toolCallID, toolName string) func() {
+	call := &mcpSessionCall{ctx: ctx, toolCallID: toolCallID, toolName: toolName}
+	mcpSessionCallsMu.Lock()
+	mcpSessionCalls[session] = call
+	mcpSessionCallsMu.Unlock()
+	return func() {
+		time.AfterFunc(mcpSessionCallGracePeriod, func() {
+			mcpSessionCallsMu.Lock()
+			defer mcpSessionCallsMu.Unlock()
+			// a pooled session may already serve another call
+			if mcpSessionCalls[session] == call {
+				delete(mcpSessionCalls, session)
+			}
+		})
+	}
+}
+
+func mcpSessionCallFor(session *mcp.ClientSession) (*mcpSessionCall, bool) {
+	if session == nil {
+		return nil, false
+	}
+	mcpSessionCallsMu.Lock()
+	defer mcpSessionCallsMu.Unlock()
+	call, ok := mcpSessionCalls[session]
+	return call, ok
+}
+
+// withMCPSessionCallContext returns the context of the tool call session is serving, if any, so
+// that requests the server makes during the call reach the run the call belongs to. The context is
+// done when either the call or ctx, that of the server's request, is done.
+func withMCPSessionCallContext(ctx context.Context, session *mcp.ClientSession) (context.Context, *mcpSessionCall, context.CancelFunc) {
+	call, ok := mcpSessionCallFor(session)
+	if !ok {
+		return ctx, nil, func() {}
+	}
+	callCtx, cancel := context.WithCancel(call.ctx)
+	stop := context.AfterFunc(ctx, cancel)
+	return callCtx, call, func() {
+		stop()
+		cancel()
+	}
+}
+
+// AGUIElicitationRequestEventName is the name of the AG-UI custom event asking the user for input.
+const AGUIElicitationRequestEventName = "elicitation_request"
+
+const defaultAGUIElicitationTimeout = 5 * time.Minute
+
+type AGUIElicitorOptions struct {
+	// Timeout bounds how long to wait for the user's response before cancelling. Defaults to 5 minutes.
+	Timeout time.Duration
+	// Fallback answers requests made outside of an AGUIHandler run. If nil, such requests are cancelled.
+	Fallback Elicitor
+}
+
+// AGUIElicitor asks the user of an AGUIHandler run for the input requested by MCP servers. It emits
+// an AG-UI custom event named "elicitation_request" carrying an "elicitation_id" along with the
+// MCPElicitationRequest, and waits for the browser to post the response to ResponseHandler.
+type AGUIElicitor struct {
+	options AGUIElicitorOptions
+
+	mu      sync.Mutex
+	pending map[string]chan MCPElicitationResponse
+}
+
+func NewAGUIElicitor(options AGUIElicitorOptions) *AGUIElicitor {
+	if options.Timeout <= 0 {
+		options.Timeout = defaultAGUIElicitationTimeout
+	}
+	return &AGUIElicitor{
+		options: options,
+		pending: make(map[string]chan MCPElicitationResponse),
+	}
+}
+
+// Elicit implements Elicitor.
+func (e *AGUIElicitor) Elicit(ctx context.Context, req MCPElicitationRequest) (MCPElicitationResponse, error) {
+	run, ok := aguiRunFromContext(ctx)
+	if !ok {
+		if e.options.Fallback != nil {
+			return e.options.Fallback(ctx, req)
+		}
+		return MCPElicitationResponse{Action: MCPElicitationCancel}, nil
+	}
+
+	elicitationID := uuid.NewString()
+	responses := make(chan MCPElicitationResponse, 1)
+	e.mu.Lock()
+	e.pending[elicitationID] = responses
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.pending, elicitationID)
+		e.mu.Unlock()
+	}()
+
+	event := events.NewCustomEvent(AGUIElicitationRequestEventName, events.WithValue(struct {
+		ElicitationID string `json:"elicitation_id"`
+		MCPElicitationRequest
+	}{ElicitationID: elicitationID, MCPElicitationRequest: req}))
+	if err := run.emit(ctx, event); err != nil {
+		return MCPElicitationResponse{}, fmt.Errorf("failed to request input: %w", err)
+	}
+
+	timer := time.NewTimer(e.options.Timeout)
+	defer timer.Stop()
+	select {
+	case response := <-responses:
+		return response, nil
+	case <-timer.C:
+		return MCPElicitationResponse{Action: MCPElicitationCancel}, nil
+	case <-ctx.Done():
+		return MCPElicitationResponse{}, ctx.Err()
+	}
+}
+
+// Respond delivers the user's response to a pending elicitation.
+func (e *AGUIElicitor) Respond(elicitationID string, response MCPElicitationResponse) error {
+	e.mu.Lock()
+	responses, ok := e.pending[elicitationID]
+	delete(e.pending, elicitationID)
+	e.mu.Unlock()
+	if !ok {
+		return errors.New("no pending elicitation with this id")
+	}
+	responses <- response
+	return nil
+}
+
+// ResponseHandler accepts responses posted by the browser as
+// {"elicitation_id": "...", "action": "accept", "content": {...}}.
+func (e *AGUIElicitor) ResponseHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			ElicitationID string `json:"elicitation_id"`
+			MCPElicitationResponse
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch input.Action {
+		case MCPElicitationAccept, MCPElicitationDecline, MCPElicitationCancel:
+		default:
+			http.Error(w, fmt.Sprintf("unknown action %q", input.Action), http.StatusBadRequest)
+			return
+		}
+		if err := e.Respond(input.ElicitationID, input.MCPElicitationResponse); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewTerminalElicitor returns an Elicitor that asks for input line by line, e.g. on a terminal or
+// from a script in tests. Each property of the requested schema is prompted for in name order;
+// reaching the end of in cancels the request.
+func NewTerminalElicitor(in io.Reader, out io.Writer) Elicitor {
+	var mu sync.Mutex
+	reader := bufio.NewReader(in)
+	readLine := func() (string, bool) {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", false
+		}
+		return strings.TrimSpace(line), true
+	}
+	return func(_ context.Context, req MCPElicitationRequest) (MCPElicitationResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		schema, err := parseMCPElicitationSchema(req.RequestedSchema)
+		if err != nil {
+			return MCPElicitationResponse{}, err
+		}
+		fmt.Fprintf(out, "%s\nProvide the requested information? [y/N]: ", req.Message)
+		answer, ok := readLine()
+		if !ok {
+			return MCPElicitationResponse{Action: MCPElicitationCancel}, nil
+		}
+		if answer = strings.ToLower(answer); answer != "y" && answer != "yes" {
+			return MCPElicitationResponse{Action: MCPElicitationDecline}, nil
+		}
+
+		content := map[string]any{}
+		for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+			property := schema.Properties[name]
+			required := slices.Contains(schema.Required, name)
+			for {
+				fmt.Fprint(out, property.prompt(name, required))
+				line, ok := readLine()
+				if !ok {
+					return MCPElicitationResponse{Action: MCPElicitationCancel}, nil
+				}
+				if line == "" && !required {
+					break
+				}
+				value, err := property.parse(line)
+				if err != nil {
+					fmt.Fprintf(out, "invalid value: %v\n", err)
+					continue
+				}
+				content[name] = value
+				break
+			}
+		}
+		return MCPElicitationResponse{Action: MCPElicitationAccept, Content: content}, nil
+	}
+}
+
+type mcpElicitationSchema struct {
+	Properties map[string]mcpElicitationProperty `json:"properties"`
+	Required   []string                          `json:"required"`
+}
+
+type mcpElicitationProperty struct {
+	Type        string   `json:"type"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Enum        []string `json:"enum"`
+}
+
+func parseMCPElicitationSchema(requested any) (mcpElicitationSchema, error) {
+	var schema mcpElicitationSchema
+	if requested == nil {
+		return schema, nil
+	}
+	b, err := json.Marshal(requested)
+	if err != nil {
+		return schema, fmt.Errorf("invalid requested schema: %w", err)
+	}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return schema, fmt.Errorf("invalid requested schema: %w", err)
+	}
+	return schema, nil
+}
+
+func (p mcpElicitationProperty) prompt(name string, required bool) string {
+	label := name
+	if p.Title != "" {
+		label = p.Title
+	}
+	if p.Description != "" {
+		label += " (" + p.Description + ")"
+	}
+	if len(p.Enum) > 0 {
+		label += " [" + strings.Join(p.Enum, "/") + "]"
+	}
+	if !required {
+		label += " (optional)"
+	}
+	return label + ": "
+}
+
+func (p mcpElicitationProperty) parse(value string) (any, error) {
+	switch p.Type {
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "integer":
+		return strconv.ParseInt(value, 10, 64)
+	case "boolean":
+		return strconv.ParseBool(value)
+	}
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, value) {
+		return nil, fmt.Errorf("must be one of %s", strings.Join(p.Enum, ", "))
+	}
+	if value == "" {
+		return nil, errors.New("a value is required")
+	}
+	return value, nil
+}
@@ -0,0 +1,180 @@
+package fantasyextensions
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newRepoMCPServer returns a server whose "create_repo" tool asks the user for the repository details.
+func newRepoMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "repos", Version: "1.0.0"}, nil)
+	server.AddTool(&mcp.Tool{Name: "create_repo", InputSchema: map[string]any{"type": "object"}}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := req.Session.Elicit(ctx, &mcp.ElicitParams{
+			Message: "Which repository should be created?",
+			RequestedSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name":    map[string]any{"type": "string", "description": "repository name"},
+					"private": map[string]any{"type": "boolean"},
+				},
+				"required": []string{"name"},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		text := "action: " + result.Action
+		if result.Action == MCPElicitationAccept {
+			text = fmt.Sprintf("created %v (private: %v)", result.Content["name"], result.Content["private"])
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: text}}}, nil
+	})
+	return server
+}
+
+func TestAGUIElicitor_RoundTrip(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name            string
+		response        map[string]any
+		expectedContent string
+	}{
+		{name: "accepted", response: map[string]any{"action": "accept", "content": map[string]any{"name": "fantasy", "private": true}}, expectedContent: "created fantasy (private: true)"},
+		{name: "declined", response: map[string]any{"action": "decline"}, expectedContent: "action: decline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			elicitor := NewAGUIElicitor(AGUIElicitorOptions{Timeout: 5 * time.Second})
+			sessionMaker, _ := newTestMCPSessionMaker(t, newRepoMCPServer(), &mcp.ClientOptions{ElicitationHandler: NewMCPElicitationHandler(elicitor.Elicit)})
+			tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{})
+			responseServer := httptest.NewServer(elicitor.ResponseHandler())
+			t.Cleanup(responseServer.Close)
+
+			events, stream := io.Pipe()
+			t.Cleanup(func() { _ = events.Close() })
+			recorder := &pipeResponseWriter{header: http.Header{}, w: stream}
+			ctx := context.WithValue(context.Background(), aguiRunContextKey{}, &aguiRun{
+				threadID: "thread-1",
+				runID:    "run-1",
+				writer:   newStreamWriter(recorder),
+			})
+
+			// the browser: wait for the elicitation request and post the response
+			go func() {
+				scanner := bufio.NewScanner(events)
+				for scanner.Scan() {
+					data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+					if !ok {
+						continue
+					}
+					var event struct {
+						Name  string `json:"name"`
+						Value struct {
+							ElicitationID string `json:"elicitation_id"`
+							ToolCallID    string `json:"tool_call_id"`
+						} `json:"value"`
+					}
+					if err := json.Unmarshal([]byte(data), &event); err != nil || event.Name != AGUIElicitationRequestEventName || event.Value.ToolCallID != "call-1" {
+						continue
+					}
+					response := map[string]any{"elicitation_id": event.Value.ElicitationID}
+					for k, v := range tt.response {
+						response[k] = v
+					}
+					body, _ := json.Marshal(response)
+					resp, err := http.Post(responseServer.URL, "application/json", strings.NewReader(string(body)))
+					if err == nil {
+						_ = resp.Body.Close()
+					}
+					return
+				}
+			}()
+
+			// When
+			resp, err := tools["create_repo"].Run(ctx, fantasy.ToolCall{ID: "call-1", Name: "create_repo", Input: "{}"})
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.IsError || resp.Content != tt.expectedContent {
+				t.Fatalf("expected %q, got %q", tt.expectedContent, resp.Content)
+			}
+		})
+	}
+}
+
+func TestAGUIElicitor_FallsBackToTerminal(t *testing.T) {
+	t.Parallel()
+	// Given
+	var prompts strings.Builder
+	elicitor := NewAGUIElicitor(AGUIElicitorOptions{
+		Fallback: NewTerminalElicitor(strings.NewReader("y\nfantasy\nmaybe\ntrue\n"), &prompts),
+	})
+	sessionMaker, _ := newTestMCPSessionMaker(t, newRepoMCPServer(), &mcp.ClientOptions{ElicitationHandler: NewMCPElicitationHandler(elicitor.Elicit)})
+	tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{})
+
+	// When
+	resp, err := tools["create_repo"].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: "create_repo", Input: "{}"})
+
+	// Then
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.IsError || resp.Content != "created fantasy (private: true)" {
+		t.Fatalf("unexpected response: %q", resp.Content)
+	}
+	expectedPrompts := "Which repository should be created?\nProvide the requested information? [y/N]: " +
+		"name (repository name): private (optional): invalid value: " +
+		`strconv.ParseBool: parsing "maybe": invalid syntax` + "\nprivate (optional): "
+	if prompts.String() != expectedPrompts {
+		t.Fatalf("expected prompts %q, got %q", expectedPrompts, prompts.String())
+	}
+}
+
+func TestTerminalElicitor(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		input          string
+		expectedAction string
+	}{
+		{name: "declined", input: "n\n", expectedAction: MCPElicitationDecline},
+		{name: "end of input", input: "y\n", expectedAction: MCPElicitationCancel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			elicitor := NewTerminalElicitor(strings.NewReader(tt.input), io.Discard)
+			req := MCPElicitationRequest{
+				Message:         "Which repository?",
+				RequestedSchema: map[string]any{"properties": map[string]any{"name": map[string]any{"type": "string"}}, "required": []string{"name"}},
+			}
+
+			// When
+			response, err := elicitor(context.Background(), req)
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if response.Action != tt.expectedAction || response.Content != nil {
+				t.Fatalf("expected action %s without content, got %+v", tt.expectedAction, response)
+			}
+		})
+	}
+}
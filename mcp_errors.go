@@ -0,0 +1,123 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"charm.land/fantasy"
+)
+
+// MCPToolErrorMetadataKey is the tool response metadata key under which MCP tool failures are described.
+const MCPToolErrorMetadataKey = "mcp_error"
+
+type MCPToolErrorKind string
+
+const (
+	// MCPToolErrorTransport means the server could not be reached or the connection failed mid-call.
+	MCPToolErrorTransport MCPToolErrorKind = "transport"
+	// MCPToolErrorProtocol means the server rejected the request or returned something unusable.
+	MCPToolErrorProtocol MCPToolErrorKind = "protocol"
+	// MCPToolErrorTool means the tool ran and reported a failure (CallToolResult.IsError).
+	MCPToolErrorTool MCPToolErrorKind = "tool"
+	// MCPToolErrorTimeout means the call did not complete before its deadline.
+	MCPToolErrorTimeout MCPToolErrorKind = "timeout"
+	// MCPToolErrorCancelled means the caller gave up on the call, e.g. because the client disconnected.
+	MCPToolErrorCancelled MCPToolErrorKind = "cancelled"
+	// MCPToolErrorInvalidArguments means the arguments didn't match the tool's input schema,
+	// so the server was not called.
+	MCPToolErrorInvalidArguments MCPToolErrorKind = "invalid_arguments"
+	// MCPToolErrorDenied means the call was not approved, so the server was not called.
+	MCPToolErrorDenied MCPToolErrorKind = "denied"
+)
+
+// Sentinel errors matching each MCPToolErrorKind with errors.Is.
+var (
+	ErrMCPTransport        = errors.New("MCP transport failure")
+	ErrMCPProtocol         = errors.New("MCP protocol error")
+	ErrMCPToolFailed       = errors.New("MCP tool reported an error")
+	ErrMCPTimeout          = errors.New("MCP call timed out")
+	ErrMCPCancelled        = errors.New("MCP call was cancelled")
+	ErrMCPInvalidArguments = errors.New("invalid MCP tool arguments")
+	ErrMCPDenied           = errors.New("MCP tool call was not approved")
+)
+
+// MCPToolError describes why an MCP tool call failed.
+type MCPToolError struct {
+	Kind     MCPToolErrorKind `json:"kind"`
+	ToolName string           `json:"tool"`
+	Message  string           `json:"message"`
+	err      error
+}
+
+func (e *MCPToolError) Error() string {
+	return e.Message
+}
+
+func (e *MCPToolError) Unwrap() error {
+	return e.err
+}
+
+func (e *MCPToolError) Is(target error) bool {
+	switch target {
+	case ErrMCPTransport:
+		return e.Kind == MCPToolErrorTransport
+	case ErrMCPProtocol:
+		return e.Kind == MCPToolErrorProtocol
+	case ErrMCPToolFailed:
+		return e.Kind == MCPToolErrorTool
+	case ErrMCPTimeout:
+		return e.Kind == MCPToolErrorTimeout
+	case ErrMCPCancelled:
+		return e.Kind == MCPToolErrorCancelled
+	case ErrMCPInvalidArguments:
+		return e.Kind == MCPToolErrorInvalidArguments
+	case ErrMCPDenied:
+		return e.Kind == MCPToolErrorDenied
+	}
+	return false
+}
+
+// MCPToolResponseError returns the *MCPToolError recorded on a response returned by an MCP tool,
+// or nil if the call succeeded.
+func MCPToolResponseError(response fantasy.ToolResponse) error {
+	if !response.IsError || response.Metadata == "" {
+		return nil
+	}
+	var metadata map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(response.Metadata), &metadata); err != nil {
+		return nil
+	}
+	raw, ok := metadata[MCPToolErrorMetadataKey]
+	if !ok {
+		return nil
+	}
+	var toolErr MCPToolError
+	if err := json.Unmarshal(raw, &toolErr); err != nil {
+		return nil
+	}
+	return &toolErr
+}
+
+func mcpToolErrorResponse(toolErr *MCPToolError) fantasy.ToolResponse {
+	return fantasy.WithResponseMetadata(fantasy.NewTextErrorResponse(toolErr.Message), map[string]any{
+		MCPToolErrorMetadataKey: toolErr,
+	})
+}
+
+// classifyMCPCallError wraps an error returned while calling an MCP tool.
+func classifyMCPCallError(ctx context.Context, toolName string, err error) *MCPToolError {
+	kind := MCPToolErrorProtocol
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		kind = MCPToolErrorTimeout
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		kind = MCPToolErrorCancelled
+	case errors.Is(err, errMCPSessionCreation) || isMCPTransportError(err) || isMCPHTTPStatusError(err):
+		kind = MCPToolErrorTransport
+	}
+	return &MCPToolError{Kind: kind, ToolName: toolName, Message: err.Error(), err: err}
+}
+
+// errMCPSessionCreation marks failures to create a session, which are always transport failures.
+var errMCPSessionCreation = errors.New("failed to create MCP session")
@@ -0,0 +1,90 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newFailingMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "failing", Version: "1.0.0"}, nil)
+	emptySchema := map[string]any{"type": "object", "properties": map[string]any{}}
+	server.AddTool(&mcp.Tool{Name: "fail", InputSchema: emptySchema}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: "repository not found"}}}, nil
+	})
+	server.AddTool(&mcp.Tool{Name: "slow", InputSchema: emptySchema}, func(ctx context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	return server
+}
+
+func TestMCPTools_ClassifiesErrors(t *testing.T) {
+	t.Parallel()
+	sessionMaker, _ := newTestMCPSessionMaker(t, newFailingMCPServer(), nil)
+	tools, err := MCPTools(context.Background(), sessionMaker)
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	toolsByName := map[string]fantasy.AgentTool{}
+	for _, tool := range tools {
+		toolsByName[tool.Info().Name] = tool
+	}
+	unreachable := &mcpFantasyTool{
+		mcpName: "fail",
+		sessions: &mcpSessionMakerProvider{sessionMaker: func(context.Context) (*mcp.ClientSession, error) {
+			return nil, errors.New("connection refused")
+		}},
+	}
+	unknown := &mcpFantasyTool{mcpName: "unknown", sessions: &mcpSessionMakerProvider{sessionMaker: sessionMaker}}
+
+	tests := []struct {
+		name             string
+		tool             fantasy.AgentTool
+		timeout          time.Duration
+		expectedKind     MCPToolErrorKind
+		expectedSentinel error
+		expectedContent  string
+	}{
+		{name: "tool error", tool: toolsByName["fail"], expectedKind: MCPToolErrorTool, expectedSentinel: ErrMCPToolFailed, expectedContent: "repository not found"},
+		{name: "timeout", tool: toolsByName["slow"], timeout: 50 * time.Millisecond, expectedKind: MCPToolErrorTimeout, expectedSentinel: ErrMCPTimeout},
+		{name: "transport", tool: unreachable, expectedKind: MCPToolErrorTransport, expectedSentinel: ErrMCPTransport},
+		{name: "protocol", tool: unknown, expectedKind: MCPToolErrorProtocol, expectedSentinel: ErrMCPProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			// When
+			resp, err := tt.tool.Run(ctx, fantasy.ToolCall{Input: `{}`})
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !resp.IsError {
+				t.Fatalf("expected an error response: %+v", resp)
+			}
+			if tt.expectedContent != "" && resp.Content != tt.expectedContent {
+				t.Fatalf("unexpected content: %s", resp.Content)
+			}
+			var toolErr *MCPToolError
+			if !errors.As(MCPToolResponseError(resp), &toolErr) {
+				t.Fatalf("expected an MCPToolError in: %s", resp.Metadata)
+			}
+			if toolErr.Kind != tt.expectedKind || !errors.Is(toolErr, tt.expectedSentinel) {
+				t.Fatalf("unexpected error: %+v", toolErr)
+			}
+		})
+	}
+}
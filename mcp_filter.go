@@ -0,0 +1,66 @@
+package fantasyextensions
+
+import (
+	"context"
+	"path"
+	"regexp"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCPToolFilter narrows the tools exposed from an MCP server. Tools must pass every criterion that is set.
+type MCPToolFilter struct {
+	// Allow, if non-empty, keeps only tools whose names match one of these names or glob
+	// patterns (path.Match syntax, e.g. "get_*").
+	Allow []string
+	// Deny drops tools whose names match any of these names or glob patterns.
+	Deny []string
+	// Match, if set, keeps only tools whose names match the regular expression.
+	Match *regexp.Regexp
+	// Predicate, if set, keeps only tools for which it returns true. Use it to filter on
+	// annotations, e.g. to hide tools that aren't read-only.
+	Predicate func(*mcp.Tool) bool
+}
+
+func (f MCPToolFilter) keep(tool *mcp.Tool) bool {
+	if len(f.Allow) > 0 && !matchesAnyToolNamePattern(tool.Name, f.Allow) {
+		return false
+	}
+	if matchesAnyToolNamePattern(tool.Name, f.Deny) {
+		return false
+	}
+	if f.Match != nil && !f.Match.MatchString(tool.Name) {
+		return false
+	}
+	if f.Predicate != nil && !f.Predicate(tool) {
+		return false
+	}
+	return true
+}
+
+func matchesAnyToolNamePattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterMCPTools narrows the MCP tools returned by toolFetcher per request, e.g. based on the
+// caller's role or the AG-UI state (see AgentContextStateKey). Tools that don't come from an
+// MCP server are passed through.
+func FilterMCPTools(toolFetcher ToolFetcher, keep func(ctx context.Context, tool *mcp.Tool) bool) ToolFetcher {
+	return func(ctx context.Context) []fantasy.AgentTool {
+		tools := toolFetcher(ctx)
+		result := make([]fantasy.AgentTool, 0, len(tools))
+		for _, tool := range tools {
+			if mcpTool, ok := tool.(MCPAgentTool); ok && !keep(ctx, mcpTool.MCPTool()) {
+				continue
+			}
+			result = append(result, tool)
+		}
+		return result
+	}
+}
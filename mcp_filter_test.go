@@ -0,0 +1,96 @@
+package fantasyextensions
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newGitHubLikeMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "github", Version: "1.0.0"}, nil)
+	readOnly := &mcp.ToolAnnotations{ReadOnlyHint: true}
+	handler := func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "ok"}}}, nil
+	}
+	emptySchema := map[string]any{"type": "object"}
+	server.AddTool(&mcp.Tool{Name: "list_issues", InputSchema: emptySchema, Annotations: readOnly}, handler)
+	server.AddTool(&mcp.Tool{Name: "get_issue", InputSchema: emptySchema, Annotations: readOnly}, handler)
+	server.AddTool(&mcp.Tool{Name: "create_issue", InputSchema: emptySchema}, handler)
+	server.AddTool(&mcp.Tool{Name: "delete_repository", InputSchema: emptySchema}, handler)
+	return server
+}
+
+func toolNames(tools []fantasy.AgentTool) []string {
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Info().Name)
+	}
+	return names
+}
+
+func TestMCPTools_FiltersTools(t *testing.T) {
+	t.Parallel()
+	sessionMaker, _ := newTestMCPSessionMaker(t, newGitHubLikeMCPServer(), nil)
+	tests := []struct {
+		name          string
+		filter        MCPToolFilter
+		expectedTools []string
+	}{
+		{name: "no filter", expectedTools: []string{"create_issue", "delete_repository", "get_issue", "list_issues"}},
+		{name: "allow list", filter: MCPToolFilter{Allow: []string{"get_issue", "list_*"}}, expectedTools: []string{"get_issue", "list_issues"}},
+		{name: "deny list", filter: MCPToolFilter{Deny: []string{"delete_*"}}, expectedTools: []string{"create_issue", "get_issue", "list_issues"}},
+		{name: "regex", filter: MCPToolFilter{Match: regexp.MustCompile(`_issues?$`)}, expectedTools: []string{"create_issue", "get_issue", "list_issues"}},
+		{
+			name:          "predicate on annotations",
+			filter:        MCPToolFilter{Predicate: func(tool *mcp.Tool) bool { return tool.Annotations != nil && tool.Annotations.ReadOnlyHint }},
+			expectedTools: []string{"get_issue", "list_issues"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// When
+			tools, err := MCPToolsWithOptions(context.Background(), sessionMaker, MCPToolsOptions{Filter: tt.filter})
+
+			// Then
+			if err != nil {
+				t.Fatalf("failed to list tools: %v", err)
+			}
+			if got := toolNames(tools); !reflect.DeepEqual(got, tt.expectedTools) {
+				t.Fatalf("unexpected tools: %v", got)
+			}
+		})
+	}
+}
+
+func TestFilterMCPTools_NarrowsToolsPerRequest(t *testing.T) {
+	t.Parallel()
+	// Given
+	type roleKey struct{}
+	sessionMaker, _ := newTestMCPSessionMaker(t, newGitHubLikeMCPServer(), nil)
+	tools, err := MCPTools(context.Background(), sessionMaker)
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	frontEndTool := &aguiFrontEndTool{toolInfo: fantasy.ToolInfo{Name: "show_chart"}}
+	toolFetcher := FilterMCPTools(func(context.Context) []fantasy.AgentTool {
+		return append([]fantasy.AgentTool{frontEndTool}, tools...)
+	}, func(ctx context.Context, tool *mcp.Tool) bool {
+		return ctx.Value(roleKey{}) == "admin" || (tool.Annotations != nil && tool.Annotations.ReadOnlyHint)
+	})
+
+	// When
+	viewerTools := toolFetcher(context.WithValue(context.Background(), roleKey{}, "viewer"))
+	adminTools := toolFetcher(context.WithValue(context.Background(), roleKey{}, "admin"))
+
+	// Then
+	if got := toolNames(viewerTools); !reflect.DeepEqual(got, []string{"show_chart", "get_issue", "list_issues"}) {
+		t.Fatalf("unexpected viewer tools: %v", got)
+	}
+	if got := len(adminTools); got != 5 {
+		t.Fatalf("expected 5 admin tools, got %d", got)
+	}
+}
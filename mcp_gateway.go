@@ -0,0 +1,509 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/yosida95/uritemplate/v3"
+)
+
+const defaultMCPGatewayName = "fantasy-extensions-gateway"
+
+type MCPGatewayOptions struct {
+	// Implementation identifies the gateway to its clients. Defaults to "fantasy-extensions-gateway" 1.0.0.
+	Implementation *mcp.Implementation
+	// ServerOptions are passed to mcp.NewServer. The gateway always advertises tools, resources
+	// and prompts, so that clients watch for changes even if no upstream server offers any yet.
+	ServerOptions *mcp.ServerOptions
+	// Separator is placed between the upstream server name and the names of its tools and prompts.
+	// Defaults to "__".
+	Separator string
+	// ToolNamer overrides how tools and prompts are named. If set, Separator is ignored. Tools whose
+	// names model providers would reject are skipped.
+	ToolNamer MCPToolNamer
+	// RequireAll fails creating the gateway if any upstream server cannot be reached. By default,
+	// unreachable servers are skipped as long as at least one server loads, and retried on Refresh.
+	RequireAll bool
+	// OnServerError is called whenever listing an upstream server fails, and for tools, resources
+	// and prompts left out because another server already publishes them under the same name.
+	// If nil, errors are logged.
+	OnServerError func(serverName string, err error)
+}
+
+// MCPGateway aggregates the tools, resources and prompts of several upstream MCP servers into a
+// single MCP server. Tools and prompts are namespaced as in MCPMultiServerTools; resources keep
+// their URIs, as these are already global. Requests are forwarded to the upstream server owning
+// the tool, prompt or resource, with progress notifications passed back and cancellation passed on.
+//
+// Each upstream's MCPToolsOptions apply: Filter, MaxTools and MaxPages narrow its tools, Timeout and
+// ToolTimeouts bound calls, and SessionPool is used for forwarded requests. Without a pool every
+// request opens a session of its own, which is costly for servers started as a subprocess.
+//
+// The gateway keeps a session open to each upstream server and re-lists it when the server
+// announces a change, notifying the gateway's clients in turn. This, and forwarding progress,
+// requires the client used by the upstream session makers to be configured with the handlers
+// below:
+//
+//	client := mcp.NewClient(impl, &mcp.ClientOptions{
+//		ToolListChangedHandler:      fantasyextensions.MCPToolListChangedHandler,
+//		ResourceListChangedHandler:  fantasyextensions.MCPResourceListChangedHandler,
+//		PromptListChangedHandler:    fantasyextensions.MCPPromptListChangedHandler,
+//		ProgressNotificationHandler: fantasyextensions.MCPProgressNotificationHandler,
+//	})
+type MCPGateway struct {
+	server    *mcp.Server
+	namer     MCPToolNamer
+	options   MCPGatewayOptions
+	upstreams []*mcpGatewayUpstream
+
+	// mu guards the names published by each upstream, and which upstream owns a name.
+	mu     sync.Mutex
+	owners map[mcpGatewayName]*mcpGatewayUpstream
+}
+
+// mcpGatewayName is a name published by the gateway: a tool or prompt name, a resource URI or a
+// resource template.
+type mcpGatewayName struct {
+	kind string
+	name string
+}
+
+// NewMCPGateway lists the upstream servers and returns a gateway publishing what they offer.
+// Serve Server() with ServeMCPStdio or MCPHTTPHandler, and Close the gateway when done.
+func NewMCPGateway(ctx context.Context, upstreams []MCPServer, options MCPGatewayOptions) (*MCPGateway, error) {
+	implementation := options.Implementation
+	if implementation == nil {
+		implementation = &mcp.Implementation{Name: defaultMCPGatewayName, Version: defaultMCPServerVersion}
+	}
+	serverOptions := &mcp.ServerOptions{}
+	if options.ServerOptions != nil {
+		copied := *options.ServerOptions
+		serverOptions = &copied
+	}
+	serverOptions.HasTools = true
+	serverOptions.HasResources = true
+	serverOptions.HasPrompts = true
+
+	namer := options.ToolNamer
+	if namer == nil {
+		separator := options.Separator
+		if separator == "" {
+			separator = defaultMCPToolNameSeparator
+		}
+		namer = func(serverName, toolName string) string {
+			return serverName + separator + toolName
+		}
+	}
+
+	g := &MCPGateway{
+		server:  mcp.NewServer(implementation, serverOptions),
+		namer:   namer,
+		options: options,
+		owners:  map[mcpGatewayName]*mcpGatewayUpstream{},
+	}
+	for _, upstream := range upstreams {
+		g.upstreams = append(g.upstreams, &mcpGatewayUpstream{
+			gateway:   g,
+			server:    upstream,
+			sessions:  newMCPSessionProvider(upstream.SessionMaker, upstream.Options),
+			tools:     map[string]*mcp.Tool{},
+			resources: map[string]*mcp.Resource{},
+			templates: map[string]*mcp.ResourceTemplate{},
+			prompts:   map[string]*mcp.Prompt{},
+		})
+	}
+
+	errs := g.refreshAll(ctx)
+	var loaded int
+	for i, upstream := range g.upstreams {
+		if errs[i] == nil {
+			loaded++
+			continue
+		}
+		if options.RequireAll {
+			g.Close()
+			return nil, fmt.Errorf("failed to load MCP server %s: %w", upstream.server.Name, errs[i])
+		}
+		g.reportError(upstream.server.Name, errs[i])
+	}
+	if loaded == 0 && len(upstreams) > 0 {
+		g.Close()
+		return nil, fmt.Errorf("failed to load any MCP server: %w", errors.Join(errs...))
+	}
+	return g, nil
+}
+
+// Server returns the MCP server publishing the aggregated tools, resources and prompts.
+func (g *MCPGateway) Server() *mcp.Server {
+	return g.server
+}
+
+// Refresh re-lists all upstream servers, reconnecting to them if needed, and updates what the
+// gateway publishes. Servers that fail keep their previous tools, resources and prompts.
+func (g *MCPGateway) Refresh(ctx context.Context) error {
+	var errs []error
+	for i, err := range g.refreshAll(ctx) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to refresh MCP server %s: %w", g.upstreams[i].server.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops watching the upstream servers. Published tools, resources and prompts remain usable.
+func (g *MCPGateway) Close() {
+	for _, upstream := range g.upstreams {
+		upstream.refreshMu.Lock()
+		upstream.closeWatch()
+		upstream.refreshMu.Unlock()
+	}
+}
+
+func (g *MCPGateway) refreshAll(ctx context.Context) []error {
+	errs := make([]error, len(g.upstreams))
+	var wg sync.WaitGroup
+	for i, upstream := range g.upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = upstream.refresh(ctx)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func (g *MCPGateway) reportError(serverName string, err error) {
+	if g.options.OnServerError != nil {
+		g.options.OnServerError(serverName, err)
+	} else {
+		log.Printf("error in MCP gateway upstream %s: %v", serverName, err)
+	}
+}
+
+// mcpGatewayUpstream is an upstream server of an MCPGateway, along with what the gateway publishes
+// on its behalf.
+type mcpGatewayUpstream struct {
+	gateway  *MCPGateway
+	server   MCPServer
+	sessions mcpSessionProvider
+
+	refreshMu sync.Mutex
+	watch     *mcp.ClientSession
+
+	// upstream definitions by their name on the gateway, guarded by gateway.mu
+	tools     map[string]*mcp.Tool
+	resources map[string]*mcp.Resource
+	templates map[string]*mcp.ResourceTemplate
+	prompts   map[string]*mcp.Prompt
+}
+
+type mcpGatewayListing struct {
+	tools     []*mcp.Tool
+	resources []*mcp.Resource
+	templates []*mcp.ResourceTemplate
+	prompts   []*mcp.Prompt
+}
+
+func (u *mcpGatewayUpstream) refresh(ctx context.Context) error {
+	u.refreshMu.Lock()
+	defer u.refreshMu.Unlock()
+
+	listing, err := u.list(ctx)
+	if err != nil && isMCPTransportError(err) {
+		u.closeWatch()
+		listing, err = u.list(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	u.publish(listing)
+	return nil
+}
+
+func (u *mcpGatewayUpstream) list(ctx context.Context) (mcpGatewayListing, error) {
+	if u.watch == nil {
+		session, err := u.server.SessionMaker(ctx)
+		if err != nil {
+			return mcpGatewayListing{}, fmt.Errorf("%w: %w", errMCPSessionCreation, err)
+		}
+		u.watch = session
+		registerMCPGatewayUpstream(session, u)
+	}
+
+	var listing mcpGatewayListing
+	var capabilities mcp.ServerCapabilities
+	if result := u.watch.InitializeResult(); result != nil && result.Capabilities != nil {
+		capabilities = *result.Capabilities
+	}
+	var err error
+	if capabilities.Tools != nil {
+		if listing.tools, err = listMCPTools(ctx, u.watch, u.server.Options); err != nil {
+			return mcpGatewayListing{}, err
+		}
+	}
+	if capabilities.Resources != nil {
+		for resource, err := range u.watch.Resources(ctx, nil) {
+			if err != nil {
+				return mcpGatewayListing{}, fmt.Errorf("failed to list resources: %w", err)
+			}
+			listing.resources = append(listing.resources, resource)
+		}
+		for template, err := range u.watch.ResourceTemplates(ctx, nil) {
+			if err != nil {
+				return mcpGatewayListing{}, fmt.Errorf("failed to list resource templates: %w", err)
+			}
+			listing.templates = append(listing.templates, template)
+		}
+	}
+	if capabilities.Prompts != nil {
+		for prompt, err := range u.watch.Prompts(ctx, nil) {
+			if err != nil {
+				return mcpGatewayListing{}, fmt.Errorf("failed to list prompts: %w", err)
+			}
+			listing.prompts = append(listing.prompts, prompt)
+		}
+	}
+	return listing, nil
+}
+
+func (u *mcpGatewayUpstream) closeWatch() {
+	if u.watch == nil {
+		return
+	}
+	unregisterMCPGatewayUpstream(u.watch)
+	_ = u.watch.Close()
+	u.watch = nil
+}
+
+// publish brings what the gateway publishes for the upstream in line with listing. Adding and
+// removing definitions makes the gateway's server notify its clients of the change.
+func (u *mcpGatewayUpstream) publish(listing mcpGatewayListing) {
+	g := u.gateway
+	server := g.server
+
+	tools := map[string]*mcp.Tool{}
+	for _, tool := range listing.tools {
+		name := g.namer(u.server.Name, tool.Name)
+		if err := checkMCPGatewayTool(tool); err != nil {
+			g.reportError(u.server.Name, err)
+			continue
+		}
+		// clients hand the gateway's tools to models, which restrict their names
+		if err := checkMCPToolName(name); err != nil {
+			g.reportError(u.server.Name, err)
+			continue
+		}
+		tools[name] = tool
+	}
+	resources := map[string]*mcp.Resource{}
+	for _, resource := range listing.resources {
+		resources[resource.URI] = resource
+	}
+	templates := map[string]*mcp.ResourceTemplate{}
+	for _, template := range listing.templates {
+		if _, err := uritemplate.New(template.URITemplate); err != nil {
+			g.reportError(u.server.Name, fmt.Errorf("invalid URI template %q: %w", template.URITemplate, err))
+			continue
+		}
+		templates[template.URITemplate] = template
+	}
+	prompts := map[string]*mcp.Prompt{}
+	for _, prompt := range listing.prompts {
+		prompts[g.namer(u.server.Name, prompt.Name)] = prompt
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	u.tools = publishMCPGatewayDefinitions(u, "tool", u.tools, tools,
+		func(name string, tool *mcp.Tool) {
+			published := *tool
+			published.Name = name
+			server.AddTool(&published, u.callTool(tool.Name))
+		},
+		server.RemoveTools)
+	u.resources = publishMCPGatewayDefinitions(u, "resource", u.resources, resources,
+		func(_ string, resource *mcp.Resource) {
+			server.AddResource(resource, u.readResource)
+		},
+		server.RemoveResources)
+	u.templates = publishMCPGatewayDefinitions(u, "resource template", u.templates, templates,
+		func(_ string, template *mcp.ResourceTemplate) {
+			server.AddResourceTemplate(template, u.readResource)
+		},
+		server.RemoveResourceTemplates)
+	u.prompts = publishMCPGatewayDefinitions(u, "prompt", u.prompts, prompts,
+		func(name string, prompt *mcp.Prompt) {
+			published := *prompt
+			published.Name = name
+			server.AddPrompt(&published, u.getPrompt(prompt.Name))
+		},
+		server.RemovePrompts)
+}
+
+// publishMCPGatewayDefinitions replaces the definitions published for an upstream with listed,
+// skipping names owned by other upstreams, and returns what is now published. The caller holds
+// the gateway's lock.
+func publishMCPGatewayDefinitions[T any](u *mcpGatewayUpstream, kind string, published, listed map[string]T,
+	add func(name string, definition T), remove func(names ...string)) map[string]T {
+	g := u.gateway
+	names := make([]string, 0, len(listed))
+	for name := range listed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if owner, ok := g.owners[mcpGatewayName{kind, name}]; ok && owner != u {
+			g.reportError(u.server.Name, fmt.Errorf("%w: %s %s is already published by %s", ErrMCPToolNameCollision, kind, name, owner.server.Name))
+			delete(listed, name)
+		}
+	}
+
+	change := diffMCPDefinitions(published, listed)
+	if len(change.Removed) > 0 {
+		for _, name := range change.Removed {
+			delete(g.owners, mcpGatewayName{kind, name})
+		}
+		remove(change.Removed...)
+	}
+	for _, name := range append(change.Added, change.Changed...) {
+		g.owners[mcpGatewayName{kind, name}] = u
+		add(name, listed[name])
+	}
+	return listed
+}
+
+// checkMCPGatewayTool rejects tools the gateway's server can't publish, as it panics on them.
+func checkMCPGatewayTool(tool *mcp.Tool) error {
+	if !isMCPObjectSchema(tool.InputSchema) {
+		return fmt.Errorf("tool %s: input schema must have type \"object\"", tool.Name)
+	}
+	if tool.OutputSchema != nil && !isMCPObjectSchema(tool.OutputSchema) {
+		return fmt.Errorf("tool %s: output schema must have type \"object\"", tool.Name)
+	}
+	return nil
+}
+
+func isMCPObjectSchema(schema any) bool {
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return false
+	}
+	var object struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(raw, &object) == nil && object.Type == "object"
+}
+
+// callTool forwards calls to the upstream tool named name. Progress notifications are passed back
+// to the caller, and the upstream call is cancelled along with the caller's request.
+func (u *mcpGatewayUpstream) callTool(name string) mcp.ToolHandler {
+	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		timeout := u.server.Options.Timeout
+		if toolTimeout, ok := u.server.Options.ToolTimeouts[name]; ok {
+			timeout = toolTimeout
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		params := &mcp.CallToolParams{Name: name}
+		if len(req.Params.Arguments) > 0 {
+			params.Arguments = req.Params.Arguments
+		}
+		ctx = withMCPProgressForwarding(ctx, req, req.Params.Name)
+		defer trackMCPProgress(ctx, params, "", req.Params.Name)()
+
+		var result *mcp.CallToolResult
+		err := u.sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+			var err error
+			result, err = session.CallTool(ctx, params)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("MCP server %s: %w", u.server.Name, err)
+		}
+		return result, nil
+	}
+}
+
+func (u *mcpGatewayUpstream) readResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	var result *mcp.ReadResourceResult
+	err := u.sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+		var err error
+		result, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: req.Params.URI})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("MCP server %s: %w", u.server.Name, err)
+	}
+	return result, nil
+}
+
+func (u *mcpGatewayUpstream) getPrompt(name string) mcp.PromptHandler {
+	return func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		var result *mcp.GetPromptResult
+		err := u.sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+			var err error
+			result, err = session.GetPrompt(ctx, &mcp.GetPromptParams{Name: name, Arguments: req.Params.Arguments})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("MCP server %s: %w", u.server.Name, err)
+		}
+		return result, nil
+	}
+}
+
+func (u *mcpGatewayUpstream) onListChanged() {
+	if err := u.refresh(context.Background()); err != nil {
+		u.gateway.reportError(u.server.Name, err)
+	}
+}
+
+var (
+	mcpGatewayUpstreamsMu sync.Mutex
+	mcpGatewayUpstreams   = map[*mcp.ClientSession]*mcpGatewayUpstream{}
+)
+
+func registerMCPGatewayUpstream(session *mcp.ClientSession, u *mcpGatewayUpstream) {
+	mcpGatewayUpstreamsMu.Lock()
+	defer mcpGatewayUpstreamsMu.Unlock()
+	mcpGatewayUpstreams[session] = u
+}
+
+func unregisterMCPGatewayUpstream(session *mcp.ClientSession) {
+	mcpGatewayUpstreamsMu.Lock()
+	defer mcpGatewayUpstreamsMu.Unlock()
+	delete(mcpGatewayUpstreams, session)
+}
+
+func refreshMCPGatewayUpstream(session *mcp.ClientSession) {
+	mcpGatewayUpstreamsMu.Lock()
+	u, ok := mcpGatewayUpstreams[session]
+	mcpGatewayUpstreamsMu.Unlock()
+	if ok {
+		// re-listing must not block the session's notification handling
+		go u.onListChanged()
+	}
+}
+
+// MCPResourceListChangedHandler refreshes the MCPGateway watching the session the notification
+// arrived on. Use it as mcp.ClientOptions.ResourceListChangedHandler.
+func MCPResourceListChangedHandler(_ context.Context, req *mcp.ResourceListChangedRequest) {
+	refreshMCPGatewayUpstream(req.Session)
+}
+
+// MCPPromptListChangedHandler refreshes the MCPGateway watching the session the notification
+// arrived on. Use it as mcp.ClientOptions.PromptListChangedHandler.
+func MCPPromptListChangedHandler(_ context.Context, req *mcp.PromptListChangedRequest) {
+	refreshMCPGatewayUpstream(req.Session)
+}
@@ -0,0 +1,301 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var gatewayUpstreamClientOptions = &mcp.ClientOptions{
+	ToolListChangedHandler:      MCPToolListChangedHandler,
+	ResourceListChangedHandler:  MCPResourceListChangedHandler,
+	PromptListChangedHandler:    MCPPromptListChangedHandler,
+	ProgressNotificationHandler: MCPProgressNotificationHandler,
+}
+
+func newTestMCPGateway(t *testing.T, upstreams map[string]*mcp.Server, options MCPGatewayOptions) *MCPGateway {
+	t.Helper()
+	var servers []MCPServer
+	for name, server := range upstreams {
+		sessionMaker, _ := newTestMCPSessionMaker(t, server, gatewayUpstreamClientOptions)
+		servers = append(servers, MCPServer{Name: name, SessionMaker: sessionMaker})
+	}
+	gateway, err := NewMCPGateway(context.Background(), servers, options)
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func listGatewayToolNames(t *testing.T, session *mcp.ClientSession) []string {
+	t.Helper()
+	var names []string
+	for tool, err := range session.Tools(context.Background(), nil) {
+		if err != nil {
+			t.Fatalf("failed to list tools: %v", err)
+		}
+		names = append(names, tool.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestMCPGateway_AggregatesUpstreams(t *testing.T) {
+	t.Parallel()
+	// Given
+	gateway := newTestMCPGateway(t, map[string]*mcp.Server{
+		"echo":     newEchoMCPServer(),
+		"handbook": newHandbookMCPServer(),
+		"prompts":  newPromptsMCPServer(),
+	}, MCPGatewayOptions{})
+	session := connectMCPServer(t, gateway.Server(), nil)
+	ctx := context.Background()
+
+	// When
+	toolNames := listGatewayToolNames(t, session)
+	echoed, echoErr := session.CallTool(ctx, &mcp.CallToolParams{Name: "echo__echo", Arguments: map[string]any{"message": "hi"}})
+	resource, resourceErr := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "docs://faq"})
+	profile, profileErr := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "users://42/profile"})
+	prompt, promptErr := session.GetPrompt(ctx, &mcp.GetPromptParams{Name: "prompts__code_review", Arguments: map[string]string{"language": "Go"}})
+
+	// Then
+	if strings.Join(toolNames, ",") != "echo__echo" {
+		t.Fatalf("expected the namespaced echo tool, got %v", toolNames)
+	}
+	if echoErr != nil || echoed.Content[0].(*mcp.TextContent).Text != "hi" {
+		t.Fatalf("unexpected echo result: %+v %v", echoed, echoErr)
+	}
+	if resourceErr != nil || resource.Contents[0].Text != "Ask away." {
+		t.Fatalf("unexpected resource: %+v %v", resource, resourceErr)
+	}
+	if profileErr != nil || profile.Contents[0].Text != "profile of users://42/profile" {
+		t.Fatalf("unexpected templated resource: %+v %v", profile, profileErr)
+	}
+	if promptErr != nil || prompt.Messages[0].Content.(*mcp.TextContent).Text != "You review Go code." {
+		t.Fatalf("unexpected prompt: %+v %v", prompt, promptErr)
+	}
+}
+
+func TestMCPGateway_AppliesUpstreamFilter(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, _ := newTestMCPSessionMaker(t, newGitHubLikeMCPServer(), gatewayUpstreamClientOptions)
+	gateway, err := NewMCPGateway(context.Background(), []MCPServer{{
+		Name:         "github",
+		SessionMaker: sessionMaker,
+		Options:      MCPToolsOptions{Filter: MCPToolFilter{Allow: []string{"list_*", "get_*"}}},
+	}}, MCPGatewayOptions{})
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	t.Cleanup(gateway.Close)
+	session := connectMCPServer(t, gateway.Server(), nil)
+
+	// When
+	toolNames := listGatewayToolNames(t, session)
+	_, callErr := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "github__delete_repository", Arguments: map[string]any{}})
+
+	// Then
+	if strings.Join(toolNames, ",") != "github__get_issue,github__list_issues" {
+		t.Fatalf("expected only the read tools, got %v", toolNames)
+	}
+	if callErr == nil {
+		t.Fatalf("expected filtered out tools not to be callable")
+	}
+}
+
+func TestMCPGateway_ForwardsProgress(t *testing.T) {
+	t.Parallel()
+	// Given
+	gateway := newTestMCPGateway(t, map[string]*mcp.Server{"indexer": newIndexingMCPServer(3)}, MCPGatewayOptions{})
+	var mu sync.Mutex
+	var progress []float64
+	session := connectMCPServer(t, gateway.Server(), &mcp.ClientOptions{
+		ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress = append(progress, req.Params.Progress)
+		},
+	})
+	params := &mcp.CallToolParams{Name: "indexer__index", Arguments: map[string]any{}, Meta: mcp.Meta{}}
+	params.SetProgressToken("token-1")
+
+	// When
+	result, err := session.CallTool(context.Background(), params)
+
+	// Then
+	if err != nil || result.Content[0].(*mcp.TextContent).Text != "indexed" {
+		t.Fatalf("unexpected result: %+v %v", result, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		got := len(progress)
+		mu.Unlock()
+		if got == 3 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected 3 progress notifications, got %v", progress)
+}
+
+func TestMCPGateway_ForwardsCancellation(t *testing.T) {
+	t.Parallel()
+	// Given
+	upstream, cancelled := newBlockingMCPServer()
+	gateway := newTestMCPGateway(t, map[string]*mcp.Server{"slow": upstream}, MCPGatewayOptions{})
+	session := connectMCPServer(t, gateway.Server(), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// When
+	_, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "slow__crawl", Arguments: map[string]any{}})
+
+	// Then
+	if err == nil {
+		t.Fatalf("expected the call to be cancelled")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the upstream call to be cancelled")
+	}
+}
+
+func TestMCPGateway_PropagatesListChanged(t *testing.T) {
+	t.Parallel()
+	// Given
+	upstream := newEchoMCPServer()
+	gateway := newTestMCPGateway(t, map[string]*mcp.Server{"echo": upstream}, MCPGatewayOptions{})
+	changed := make(chan struct{}, 10)
+	session := connectMCPServer(t, gateway.Server(), &mcp.ClientOptions{
+		ToolListChangedHandler: func(context.Context, *mcp.ToolListChangedRequest) { changed <- struct{}{} },
+	})
+
+	// When
+	mcp.AddTool(upstream, &mcp.Tool{Name: "shout"}, func(_ context.Context, _ *mcp.CallToolRequest, input echoInput) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: strings.ToUpper(input.Message)}}}, nil, nil
+	})
+	upstream.RemoveTools("echo")
+
+	// Then
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("expected the tools to change, got %v", listGatewayToolNames(t, session))
+		}
+		if strings.Join(listGatewayToolNames(t, session), ",") == "echo__shout" {
+			return
+		}
+	}
+}
+
+func TestMCPGateway_Collisions(t *testing.T) {
+	t.Parallel()
+	// Given
+	var mu sync.Mutex
+	var errs []error
+	gateway := newTestMCPGateway(t, map[string]*mcp.Server{
+		"a": newEchoMCPServer(),
+		"b": newEchoMCPServer(),
+	}, MCPGatewayOptions{
+		ToolNamer: UnprefixedMCPToolNames,
+		OnServerError: func(_ string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	session := connectMCPServer(t, gateway.Server(), nil)
+
+	// When
+	toolNames := listGatewayToolNames(t, session)
+
+	// Then
+	if strings.Join(toolNames, ",") != "echo" {
+		t.Fatalf("expected a single echo tool, got %v", toolNames)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrMCPToolNameCollision) {
+		t.Fatalf("expected a collision to be reported, got %v", errs)
+	}
+}
+
+func TestMCPGateway_SkipsInvalidToolNames(t *testing.T) {
+	t.Parallel()
+	// Given
+	var mu sync.Mutex
+	var errs []error
+	gateway := newTestMCPGateway(t, map[string]*mcp.Server{
+		"a":       newEchoMCPServer(),
+		"docs v2": newEchoMCPServer(),
+	}, MCPGatewayOptions{
+		OnServerError: func(_ string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	session := connectMCPServer(t, gateway.Server(), nil)
+
+	// When
+	toolNames := listGatewayToolNames(t, session)
+
+	// Then
+	if strings.Join(toolNames, ",") != "a__echo" {
+		t.Fatalf("expected only the validly named tool, got %v", toolNames)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrMCPInvalidToolName) {
+		t.Fatalf("expected the invalid name to be reported, got %v", errs)
+	}
+}
+
+func TestNewMCPGateway_UnreachableUpstreams(t *testing.T) {
+	t.Parallel()
+	failing := MCPServer{Name: "down", SessionMaker: func(context.Context) (*mcp.ClientSession, error) {
+		return nil, errors.New("connection refused")
+	}}
+	sessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	working := MCPServer{Name: "echo", SessionMaker: sessionMaker}
+	tests := []struct {
+		name          string
+		upstreams     []MCPServer
+		requireAll    bool
+		expectedError bool
+	}{
+		{name: "skipped when others load", upstreams: []MCPServer{failing, working}},
+		{name: "required", upstreams: []MCPServer{failing, working}, requireAll: true, expectedError: true},
+		{name: "none loads", upstreams: []MCPServer{failing}, expectedError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// When
+			gateway, err := NewMCPGateway(context.Background(), tt.upstreams, MCPGatewayOptions{
+				RequireAll:    tt.requireAll,
+				OnServerError: func(string, error) {},
+			})
+
+			// Then
+			if (err != nil) != tt.expectedError {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if gateway != nil {
+				gateway.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+
+	"github.com/ag-ui-protocol/ag-ui/sdks/community/go/pkg/core/events"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// AGUIMCPLogEventName is the name of the AG-UI custom event carrying an MCPLogMessage.
+const AGUIMCPLogEventName = "mcp_log"
+
+const defaultMCPLoggingLevel mcp.LoggingLevel = "info"
+
+type MCPLoggingOptions struct {
+	// Logger receives the messages. Defaults to slog.Default().
+	Logger *slog.Logger
+	// Level is the least severe level servers are asked to send. Defaults to "info".
+	Level mcp.LoggingLevel
+	// AGUIDebugEvents additionally streams messages logged during tool calls of an AGUIHandler run
+	// to the client as "mcp_log" custom events. Meant for development, as logs may be sensitive.
+	AGUIDebugEvents bool
+}
+
+// MCPLogMessage is a log message sent by an MCP server.
+type MCPLogMessage struct {
+	ServerName string           `json:"server_name,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	ToolName   string           `json:"tool_name,omitempty"`
+	Level      mcp.LoggingLevel `json:"level"`
+	Logger     string           `json:"logger,omitempty"`
+	Data       any              `json:"data"`
+}
+
+// MCPLogBridge forwards the log messages of MCP servers into structured logging. Messages are
+// tagged with the server name and, when logged during a tool call, the tool and the AG-UI thread
+// and run the call belongs to.
+//
+//	bridge := fantasyextensions.NewMCPLogBridge(fantasyextensions.MCPLoggingOptions{Level: "debug"})
+//	client := mcp.NewClient(impl, &mcp.ClientOptions{LoggingMessageHandler: bridge.Handle})
+//	sessionMaker = bridge.SessionMaker(sessionMaker)
+type MCPLogBridge struct {
+	options MCPLoggingOptions
+}
+
+func NewMCPLogBridge(options MCPLoggingOptions) *MCPLogBridge {
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+	if options.Level == "" {
+		options.Level = defaultMCPLoggingLevel
+	}
+	return &MCPLogBridge{options: options}
+}
+
+// SessionMaker wraps sessionMaker so that every new session asks its server, via logging/setLevel,
+// to send messages at the configured level and above. Servers only send messages once asked to.
+func (b *MCPLogBridge) SessionMaker(sessionMaker MCPSessionMaker) MCPSessionMaker {
+	return func(ctx context.Context) (*mcp.ClientSession, error) {
+		session, err := sessionMaker(ctx)
+		if err != nil {
+			return nil, err
+		}
+		initResult := session.InitializeResult()
+		if initResult == nil || initResult.Capabilities == nil || initResult.Capabilities.Logging == nil {
+			return session, nil
+		}
+		if err := session.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: b.options.Level}); err != nil {
+			b.options.Logger.WarnContext(ctx, "failed to set MCP server log level",
+				"server", mcpServerName(session), "level", b.options.Level, "error", err)
+		}
+		return session, nil
+	}
+}
+
+// Handle forwards a log message. Use it as mcp.ClientOptions.LoggingMessageHandler.
+func (b *MCPLogBridge) Handle(ctx context.Context, req *mcp.LoggingMessageRequest) {
+	if req.Params == nil {
+		return
+	}
+	message := MCPLogMessage{
+		ServerName: mcpServerName(req.Session),
+		Level:      req.Params.Level,
+		Logger:     req.Params.Logger,
+		Data:       req.Params.Data,
+	}
+	attrs := []slog.Attr{slog.String("server", message.ServerName)}
+	if message.Logger != "" {
+		attrs = append(attrs, slog.String("logger", message.Logger))
+	}
+	if call, ok := mcpSessionCallFor(req.Session); ok {
+		message.ToolCallID = call.toolCallID
+		message.ToolName = call.toolName
+		attrs = append(attrs, slog.String("tool", call.toolName), slog.String("tool_call_id", call.toolCallID))
+		if run, ok := aguiRunFromContext(call.ctx); ok {
+			attrs = append(attrs, slog.String("thread_id", run.threadID), slog.String("run_id", run.runID))
+			if b.options.AGUIDebugEvents {
+				// the run may have finished by the time notifications sent during the call are handled
+				if err := run.emit(call.ctx, events.NewCustomEvent(AGUIMCPLogEventName, events.WithValue(message))); err != nil && !errors.Is(err, errAGUIRunFinished) {
+					log.Printf("error writing MCP log event: %v", err)
+				}
+			}
+		}
+	}
+
+	msg, ok := message.Data.(string)
+	if !ok {
+		msg = "MCP server log"
+		attrs = append(attrs, slog.Any("data", message.Data))
+	}
+	b.options.Logger.LogAttrs(ctx, mcpLogLevelToSlog(message.Level), msg, attrs...)
+}
+
+func mcpServerName(session *mcp.ClientSession) string {
+	if session == nil || session.InitializeResult() == nil || session.InitializeResult().ServerInfo == nil {
+		return ""
+	}
+	return session.InitializeResult().ServerInfo.Name
+}
+
+func mcpLogLevelToSlog(level mcp.LoggingLevel) slog.Level {
+	switch level {
+	case "debug":
+		return mcp.LevelDebug
+	case "info":
+		return mcp.LevelInfo
+	case "notice":
+		return mcp.LevelNotice
+	case "warning":
+		return mcp.LevelWarning
+	case "error":
+		return mcp.LevelError
+	case "critical":
+		return mcp.LevelCritical
+	case "alert":
+		return mcp.LevelAlert
+	case "emergency":
+		return mcp.LevelEmergency
+	}
+	return mcp.LevelInfo
+}
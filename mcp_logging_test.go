@@ -0,0 +1,146 @@
+package fantasyextensions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newDeployMCPServer returns a server whose "deploy" tool logs at several levels.
+func newDeployMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "ops", Version: "1.0.0"}, nil)
+	server.AddTool(&mcp.Tool{Name: "deploy", InputSchema: map[string]any{"type": "object"}}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		logs := []*mcp.LoggingMessageParams{
+			{Level: "debug", Data: "resolving targets"},
+			{Level: "info", Logger: "deployer", Data: "deploying to staging"},
+			{Level: "error", Data: map[string]any{"target": "prod", "reason": "quota exceeded"}},
+		}
+		for _, params := range logs {
+			if err := req.Session.Log(ctx, params); err != nil {
+				return nil, err
+			}
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "deployed"}}}, nil
+	})
+	return server
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMCPLogBridge(t *testing.T) {
+	t.Parallel()
+	// Given
+	var output syncBuffer
+	bridge := NewMCPLogBridge(MCPLoggingOptions{
+		Logger:          slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		AGUIDebugEvents: true,
+	})
+	sessionMaker, _ := newTestMCPSessionMaker(t, newDeployMCPServer(), &mcp.ClientOptions{LoggingMessageHandler: bridge.Handle})
+	tools := mcpToolsByName(t, bridge.SessionMaker(sessionMaker), MCPToolsOptions{})
+	recorder := httptest.NewRecorder()
+	ctx := context.WithValue(context.Background(), aguiRunContextKey{}, &aguiRun{
+		threadID: "thread-1",
+		runID:    "run-1",
+		writer:   newStreamWriter(recorder),
+	})
+
+	// When
+	resp, err := tools["deploy"].Run(ctx, fantasy.ToolCall{ID: "call-1", Name: "deploy", Input: "{}"})
+
+	// Then
+	if err != nil || resp.IsError {
+		t.Fatalf("unexpected error: %v %s", err, resp.Content)
+	}
+	var records []map[string]any
+	deadline := time.Now().Add(5 * time.Second)
+	for len(records) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		records = records[:0]
+		for line := range strings.Lines(output.String()) {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("invalid log line %q: %v", line, err)
+			}
+			records = append(records, record)
+		}
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected the info and error messages only, got %v", records)
+	}
+	expected := []map[string]any{
+		{"level": "INFO", "msg": "deploying to staging", "server": "ops", "logger": "deployer", "tool": "deploy", "tool_call_id": "call-1", "thread_id": "thread-1", "run_id": "run-1"},
+		{"level": "ERROR", "msg": "MCP server log", "server": "ops", "tool": "deploy", "tool_call_id": "call-1", "thread_id": "thread-1", "run_id": "run-1"},
+	}
+	for i, want := range expected {
+		for key, value := range want {
+			if records[i][key] != value {
+				t.Fatalf("expected %s=%v in record %d, got %v", key, value, i, records[i])
+			}
+		}
+	}
+	if data, _ := records[1]["data"].(map[string]any); data["reason"] != "quota exceeded" {
+		t.Fatalf("expected the structured data to be logged, got %v", records[1])
+	}
+	if events := recorder.Body.String(); strings.Count(events, `"name":"`+AGUIMCPLogEventName+`"`) != 2 || !strings.Contains(events, `"server_name":"ops"`) {
+		t.Fatalf("expected 2 %s events, got %s", AGUIMCPLogEventName, events)
+	}
+}
+
+func TestMCPLogBridge_DoesNotEmitAfterRunFinished(t *testing.T) {
+	t.Parallel()
+	// Given
+	var output syncBuffer
+	bridge := NewMCPLogBridge(MCPLoggingOptions{
+		Logger:          slog.New(slog.NewJSONHandler(&output, nil)),
+		AGUIDebugEvents: true,
+	})
+	sessionMaker, _ := newTestMCPSessionMaker(t, newDeployMCPServer(), &mcp.ClientOptions{LoggingMessageHandler: bridge.Handle})
+	tools := mcpToolsByName(t, bridge.SessionMaker(sessionMaker), MCPToolsOptions{})
+	recorder := httptest.NewRecorder()
+	run := &aguiRun{threadID: "thread-1", runID: "run-1", writer: newStreamWriter(recorder)}
+	run.finish()
+	ctx := context.WithValue(context.Background(), aguiRunContextKey{}, run)
+
+	// When
+	resp, err := tools["deploy"].Run(ctx, fantasy.ToolCall{ID: "call-1", Name: "deploy", Input: "{}"})
+
+	// Then
+	if err != nil || resp.IsError {
+		t.Fatalf("unexpected error: %v %s", err, resp.Content)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(output.String(), "\n") < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := strings.Count(output.String(), "\n"); got != 2 {
+		t.Fatalf("expected the messages to still be logged, got %q", output.String())
+	}
+	if events := recorder.Body.String(); events != "" {
+		t.Fatalf("expected no events once the run has finished, got %s", events)
+	}
+}
@@ -0,0 +1,106 @@
+package fantasyextensions
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// MCPToolMediaMetadataKey is the tool response metadata key under which binary
+// content returned by MCP tools is carried.
+//
+// fantasy passes tool responses to the model as text, so media is kept out of the response
+// content (which only references it) and preserved in the metadata for UIs and middleware.
+// AGUIHandler forwards it to the browser in a "tool_media" event.
+const MCPToolMediaMetadataKey = "media"
+
+type MCPMediaOptions struct {
+	// MaxBytes drops media larger than this, after any downscaling. Zero means no limit.
+	MaxBytes int
+	// MaxImageDimension downscales PNG, JPEG and GIF images whose width or height exceeds it,
+	// preserving the aspect ratio. Zero disables downscaling.
+	MaxImageDimension int
+}
+
+// MCPToolMedia is binary content (images, audio, blob resources) returned by an MCP tool.
+type MCPToolMedia struct {
+	// Type is "image", "audio", or "resource" for other binary resources.
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	// Data is base64 encoded.
+	Data string `json:"data"`
+}
+
+// mcpToolMedia converts raw media into MCPToolMedia, applying the options. It returns the text
+// the model sees in place of the media, and false if the media was dropped.
+func mcpToolMedia(kind, mediaType string, data []byte, options MCPMediaOptions) (MCPToolMedia, string, bool) {
+	if kind == "image" && options.MaxImageDimension > 0 {
+		if scaled, scaledType, ok := downscaleImage(data, mediaType, options.MaxImageDimension); ok {
+			data, mediaType = scaled, scaledType
+		}
+	}
+	if options.MaxBytes > 0 && len(data) > options.MaxBytes {
+		return MCPToolMedia{}, fmt.Sprintf("[%s omitted: %s, %d bytes exceeds the %d byte limit]", kind, mediaType, len(data), options.MaxBytes), false
+	}
+	media := MCPToolMedia{
+		Type:      kind,
+		MediaType: mediaType,
+		Data:      base64.StdEncoding.EncodeToString(data),
+	}
+	return media, fmt.Sprintf("[%s: %s, %d bytes]", kind, mediaType, len(data)), true
+}
+
+// downscaleImage shrinks an image so neither side exceeds maxDimension. JPEGs are re-encoded as
+// JPEG and everything else as PNG. It returns false if the image is small enough or can't be decoded.
+func downscaleImage(data []byte, mediaType string, maxDimension int) ([]byte, string, bool) {
+	var src image.Image
+	var err error
+	switch mediaType {
+	case "image/png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "image/jpeg", "image/jpg":
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/gif":
+		src, err = gif.Decode(bytes.NewReader(data))
+	default:
+		return nil, "", false
+	}
+	if err != nil {
+		return nil, "", false
+	}
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxDimension && height <= maxDimension {
+		return nil, "", false
+	}
+	scaledWidth, scaledHeight := maxDimension, maxDimension
+	if width > height {
+		scaledHeight = max(1, height*maxDimension/width)
+	} else {
+		scaledWidth = max(1, width*maxDimension/height)
+	}
+
+	// nearest neighbour is good enough for previews sent to a model
+	dst := image.NewNRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
+	for y := range scaledHeight {
+		for x := range scaledWidth {
+			dst.Set(x, y, src.At(bounds.Min.X+x*width/scaledWidth, bounds.Min.Y+y*height/scaledHeight))
+		}
+	}
+
+	var buf bytes.Buffer
+	if mediaType == "image/jpeg" || mediaType == "image/jpg" {
+		if err := jpeg.Encode(&buf, dst, nil); err != nil {
+			return nil, "", false
+		}
+		return buf.Bytes(), "image/jpeg", true
+	}
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, "", false
+	}
+	return buf.Bytes(), "image/png", true
+}
@@ -0,0 +1,91 @@
+package fantasyextensions
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newScreenshotMCPServer(t *testing.T) *mcp.Server {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 100, 50))); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	server := mcp.NewServer(&mcp.Implementation{Name: "screenshot", Version: "1.0.0"}, nil)
+	server.AddTool(&mcp.Tool{Name: "screenshot", InputSchema: map[string]any{"type": "object", "properties": map[string]any{}}}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{
+			&mcp.TextContent{Text: "here is the page"},
+			&mcp.ImageContent{MIMEType: "image/png", Data: buf.Bytes()},
+			&mcp.AudioContent{MIMEType: "audio/wav", Data: []byte("RIFF....WAVE")},
+		}}, nil
+	})
+	return server
+}
+
+func TestMCPTools_ConvertsImageAndAudioContent(t *testing.T) {
+	t.Parallel()
+	sessionMaker, _ := newTestMCPSessionMaker(t, newScreenshotMCPServer(t), nil)
+	tests := []struct {
+		name          string
+		media         MCPMediaOptions
+		expectedMedia int
+		expectedImage image.Point
+	}{
+		{name: "as is", expectedMedia: 2, expectedImage: image.Pt(100, 50)},
+		{name: "downscaled", media: MCPMediaOptions{MaxImageDimension: 10}, expectedMedia: 2, expectedImage: image.Pt(10, 5)},
+		{name: "capped", media: MCPMediaOptions{MaxBytes: 20}, expectedMedia: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			tools, err := MCPToolsWithOptions(context.Background(), sessionMaker, MCPToolsOptions{Media: tt.media})
+			if err != nil {
+				t.Fatalf("failed to list tools: %v", err)
+			}
+
+			// When
+			resp, err := tools[0].Run(context.Background(), fantasy.ToolCall{Name: "screenshot", Input: `{}`})
+
+			// Then
+			if err != nil || resp.IsError {
+				t.Fatalf("unexpected response: %+v, %v", resp, err)
+			}
+			if !strings.HasPrefix(resp.Content, "here is the page\n[image") {
+				t.Fatalf("unexpected content: %s", resp.Content)
+			}
+			var metadata struct {
+				Media []MCPToolMedia `json:"media"`
+			}
+			if err := json.Unmarshal([]byte(resp.Metadata), &metadata); err != nil {
+				t.Fatalf("failed to unmarshal metadata: %v", err)
+			}
+			if len(metadata.Media) != tt.expectedMedia {
+				t.Fatalf("expected %d media, got %d", tt.expectedMedia, len(metadata.Media))
+			}
+			last := metadata.Media[len(metadata.Media)-1]
+			if last.Type != "audio" || last.MediaType != "audio/wav" {
+				t.Fatalf("unexpected audio: %+v", last)
+			}
+			if tt.expectedMedia < 2 {
+				return
+			}
+			data, _ := base64.StdEncoding.DecodeString(metadata.Media[0].Data)
+			config, err := png.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("failed to decode image: %v", err)
+			}
+			if got := image.Pt(config.Width, config.Height); got != tt.expectedImage {
+				t.Fatalf("expected image of size %v, got %v", tt.expectedImage, got)
+			}
+		})
+	}
+}
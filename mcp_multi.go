@@ -0,0 +1,167 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ErrMCPToolNameCollision is returned when two tools end up with the same name after namespacing.
+var ErrMCPToolNameCollision = errors.New("MCP tool name collision")
+
+// ErrMCPInvalidToolName is reported for tools whose namespaced name isn't accepted by model
+// providers, and returned when a server name or separator would make every name invalid.
+var ErrMCPInvalidToolName = errors.New("invalid MCP tool name")
+
+const defaultMCPToolNameSeparator = "__"
+
+// mcpToolNamePattern matches the tool names accepted by all major providers.
+var mcpToolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// mcpToolNamePrefixPattern matches the prefixes that leave room for at least one character of the
+// tool name.
+var mcpToolNamePrefixPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{0,63}$`)
+
+func checkMCPToolName(name string) error {
+	if !mcpToolNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q must match %s", ErrMCPInvalidToolName, name, mcpToolNamePattern)
+	}
+	return nil
+}
+
+// MCPServer names an MCP server so its tools can be namespaced.
+type MCPServer struct {
+	Name         string
+	SessionMaker MCPSessionMaker
+	Options      MCPToolsOptions
+}
+
+// MCPToolNamer returns the name a tool is exposed under to the model. Names must be 1 to 64
+// letters, digits, underscores or dashes, as model providers require.
+type MCPToolNamer func(serverName, toolName string) string
+
+// UnprefixedMCPToolNames exposes tools under their original names, relying on collision detection alone.
+func UnprefixedMCPToolNames(_, toolName string) string {
+	return toolName
+}
+
+type MCPMultiServerOptions struct {
+	// Separator is placed between the server name and the tool name. Defaults to "__",
+	// which is accepted by all major providers.
+	Separator string
+	// ToolNamer overrides how tools are named. If set, Separator is ignored.
+	ToolNamer MCPToolNamer
+	// RequireAll fails loading if any server cannot be reached. By default, unreachable
+	// servers are skipped as long as at least one server loads.
+	RequireAll bool
+	// OnServerError is called for every server that fails to load, and for every tool skipped
+	// because its namespaced name is invalid. If nil, errors are logged.
+	OnServerError func(serverName string, err error)
+}
+
+// MCPMultiServerTools loads tools from several MCP servers, namespacing their names so that they
+// don't collide. Calls are routed back to the originating server under the original tool name.
+// Tools whose namespaced names model providers would reject are skipped.
+func MCPMultiServerTools(ctx context.Context, servers []MCPServer, options MCPMultiServerOptions) ([]fantasy.AgentTool, error) {
+	namer := options.ToolNamer
+	if namer == nil {
+		separator := options.Separator
+		if separator == "" {
+			separator = defaultMCPToolNameSeparator
+		}
+		for _, server := range servers {
+			if prefix := server.Name + separator; !mcpToolNamePrefixPattern.MatchString(prefix) {
+				return nil, fmt.Errorf("%w: server name and separator %q must match %s", ErrMCPInvalidToolName, prefix, mcpToolNamePrefixPattern)
+			}
+		}
+		namer = func(serverName, toolName string) string {
+			return serverName + separator + toolName
+		}
+	}
+	reportError := func(serverName string, err error) {
+		if options.OnServerError != nil {
+			options.OnServerError(serverName, err)
+		} else {
+			log.Printf("error loading tools from MCP server %s: %v", serverName, err)
+		}
+	}
+
+	serverTools := make([][]*mcpFantasyTool, len(servers))
+	serverErrs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serverTools[i], serverErrs[i] = loadMCPServerTools(ctx, server)
+		}()
+	}
+	wg.Wait()
+
+	var result []fantasy.AgentTool
+	origins := map[string]string{}
+	var collisions []string
+	var loaded int
+	for i, server := range servers {
+		if err := serverErrs[i]; err != nil {
+			if options.RequireAll {
+				return nil, fmt.Errorf("failed to load tools from MCP server %s: %w", server.Name, err)
+			}
+			reportError(server.Name, err)
+			continue
+		}
+		loaded++
+		for _, tool := range serverTools[i] {
+			name := namer(server.Name, tool.mcpName)
+			if err := checkMCPToolName(name); err != nil {
+				reportError(server.Name, err)
+				continue
+			}
+			if origin, ok := origins[name]; ok {
+				collisions = append(collisions, fmt.Sprintf("%s (%s, %s)", name, origin, server.Name))
+				continue
+			}
+			origins[name] = server.Name
+			tool.toolInfo.Name = name
+			result = append(result, tool)
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return nil, fmt.Errorf("%w: %s", ErrMCPToolNameCollision, strings.Join(collisions, ", "))
+	}
+	if loaded == 0 && len(servers) > 0 {
+		return nil, fmt.Errorf("failed to load tools from any MCP server: %w", errors.Join(serverErrs...))
+	}
+	return result, nil
+}
+
+func loadMCPServerTools(ctx context.Context, server MCPServer) ([]*mcpFantasyTool, error) {
+	sessions := newMCPSessionProvider(server.SessionMaker, server.Options)
+	var mcpTools []*mcp.Tool
+	err := sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+		var err error
+		mcpTools, err = listMCPTools(ctx, session, server.Options)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	tools := make([]*mcpFantasyTool, 0, len(mcpTools))
+	for _, mcpTool := range mcpTools {
+		tool, err := newMCPFantasyTool(mcpTool, sessions, server.Options)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, tool)
+	}
+	return tools, nil
+}
@@ -0,0 +1,147 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestMCPMultiServerTools_NamespacesAndRoutesTools(t *testing.T) {
+	t.Parallel()
+	// Given
+	githubSessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	jiraSessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	servers := []MCPServer{
+		{Name: "github", SessionMaker: githubSessionMaker},
+		{Name: "jira", SessionMaker: jiraSessionMaker},
+	}
+
+	// When
+	tools, err := MCPMultiServerTools(context.Background(), servers, MCPMultiServerOptions{})
+
+	// Then
+	if err != nil {
+		t.Fatalf("failed to load tools: %v", err)
+	}
+	if len(tools) != 2 || tools[0].Info().Name != "github__echo" || tools[1].Info().Name != "jira__echo" {
+		t.Fatalf("unexpected tools: %v", tools)
+	}
+	resp, err := tools[1].Run(context.Background(), fantasy.ToolCall{Name: "jira__echo", Input: `{"message": "hi"}`})
+	if err != nil || resp.IsError || resp.Content != "hi" {
+		t.Fatalf("unexpected response: %+v, %v", resp, err)
+	}
+}
+
+func TestMCPMultiServerTools_DetectsCollisions(t *testing.T) {
+	t.Parallel()
+	// Given
+	githubSessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	jiraSessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	servers := []MCPServer{
+		{Name: "github", SessionMaker: githubSessionMaker},
+		{Name: "jira", SessionMaker: jiraSessionMaker},
+	}
+
+	// When
+	_, err := MCPMultiServerTools(context.Background(), servers, MCPMultiServerOptions{ToolNamer: UnprefixedMCPToolNames})
+
+	// Then
+	if !errors.Is(err, ErrMCPToolNameCollision) {
+		t.Fatalf("expected collision error, got: %v", err)
+	}
+}
+
+func TestMCPMultiServerTools_ToleratesServersBeingDown(t *testing.T) {
+	t.Parallel()
+	// Given
+	githubSessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	downSessionMaker := func(context.Context) (*mcp.ClientSession, error) {
+		return nil, errors.New("connection refused")
+	}
+	servers := []MCPServer{
+		{Name: "github", SessionMaker: githubSessionMaker},
+		{Name: "jira", SessionMaker: downSessionMaker},
+	}
+	var failed []string
+
+	// When
+	tools, err := MCPMultiServerTools(context.Background(), servers, MCPMultiServerOptions{
+		OnServerError: func(serverName string, _ error) { failed = append(failed, serverName) },
+	})
+
+	// Then
+	if err != nil {
+		t.Fatalf("failed to load tools: %v", err)
+	}
+	if len(tools) != 1 || len(failed) != 1 || failed[0] != "jira" {
+		t.Fatalf("unexpected result: tools=%v failed=%v", tools, failed)
+	}
+	if _, err := MCPMultiServerTools(context.Background(), servers, MCPMultiServerOptions{RequireAll: true}); err == nil {
+		t.Fatalf("expected an error when all servers are required")
+	}
+}
+
+func TestMCPMultiServerTools_RejectsInvalidServerNames(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		serverName string
+		options    MCPMultiServerOptions
+	}{
+		{name: "server name with spaces", serverName: "git hub"},
+		{name: "custom separator", serverName: "github", options: MCPMultiServerOptions{Separator: "."}},
+		{name: "too long", serverName: strings.Repeat("github", 11)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			sessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+			servers := []MCPServer{{Name: tt.serverName, SessionMaker: sessionMaker}}
+
+			// When
+			_, err := MCPMultiServerTools(context.Background(), servers, tt.options)
+
+			// Then
+			if !errors.Is(err, ErrMCPInvalidToolName) {
+				t.Fatalf("expected an invalid tool name error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestMCPMultiServerTools_SkipsInvalidToolNames(t *testing.T) {
+	t.Parallel()
+	// Given
+	docsServer := newEchoMCPServer()
+	docsServer.AddTool(&mcp.Tool{Name: "docs.search", InputSchema: map[string]any{"type": "object"}}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return &mcp.CallToolResult{}, nil
+	})
+	docsSessionMaker, _ := newTestMCPSessionMaker(t, docsServer, nil)
+	githubSessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	servers := []MCPServer{
+		{Name: "docs", SessionMaker: docsSessionMaker},
+		{Name: "github", SessionMaker: githubSessionMaker},
+	}
+	var reported []error
+
+	// When
+	tools, err := MCPMultiServerTools(context.Background(), servers, MCPMultiServerOptions{
+		OnServerError: func(_ string, err error) { reported = append(reported, err) },
+	})
+
+	// Then
+	if err != nil {
+		t.Fatalf("failed to load tools: %v", err)
+	}
+	if len(tools) != 2 || tools[0].Info().Name != "docs__echo" || tools[1].Info().Name != "github__echo" {
+		t.Fatalf("unexpected tools: %v", tools)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrMCPInvalidToolName) {
+		t.Fatalf("expected the invalid tool name to be reported, got: %v", reported)
+	}
+}
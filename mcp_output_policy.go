@@ -0,0 +1,209 @@
+package fantasyextensions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"charm.land/fantasy"
+)
+
+// MCPToolOriginalOutputMetadataKey is the tool response metadata key under which the full output of
+// a tool is kept when MCPOutputPolicy shortened it, so that UIs can still show it. AGUIHandler
+// forwards it to the browser in a "tool_original_output" event.
+const MCPToolOriginalOutputMetadataKey = "original_output"
+
+// Ways in which MCPOutputPolicy shortens oversized output.
+const (
+	MCPOutputPruned     = "pruned"
+	MCPOutputSummarized = "summarized"
+	MCPOutputTruncated  = "truncated"
+)
+
+const (
+	// mcpOutputBytesPerToken estimates the size of a token, which is about four bytes of English
+	// text or JSON for the tokenizers of major providers.
+	mcpOutputBytesPerToken = 4
+
+	defaultMCPOutputSummaryMaxTokens      = 1024
+	defaultMCPOutputSummaryInputMaxTokens = 32_000
+)
+
+// MCPOutputPolicy keeps oversized tool output from blowing the model's context window. Output
+// longer than MaxTokens is, in turn:
+//
+//   - pruned, if it is JSON and MaxArrayItems is set, by dropping array items beyond the first
+//     MaxArrayItems;
+//   - summarized, if SummaryModel is set;
+//   - truncated, keeping its head and tail around a marker telling how much was left out.
+//
+// Sizes are estimated at four bytes per token. The full output is kept in the response metadata.
+type MCPOutputPolicy struct {
+	// MaxTokens caps the estimated size of tool output passed to the model. Zero means no limit.
+	MaxTokens int
+	// ToolMaxTokens overrides MaxTokens for individual tools, keyed by the tool's name on the
+	// server. A negative value means no limit.
+	ToolMaxTokens map[string]int
+	// MaxArrayItems is the number of items kept of every array in oversized JSON output. Zero
+	// disables pruning.
+	MaxArrayItems int
+	// SummaryModel, if set, summarizes oversized output that pruning didn't shrink enough.
+	// Output is truncated if summarizing fails.
+	SummaryModel fantasy.LanguageModel
+	// SummaryMaxTokens bounds the summary. Defaults to MaxTokens or 1024, whichever is lower.
+	SummaryMaxTokens int
+	// SummaryInputMaxTokens caps how much of the output is given to SummaryModel, the rest being
+	// truncated. Defaults to 32000.
+	SummaryInputMaxTokens int
+}
+
+// MCPOriginalOutput is the full output of a tool whose output was shortened.
+type MCPOriginalOutput struct {
+	// Method is MCPOutputPruned, MCPOutputSummarized or MCPOutputTruncated.
+	Method  string `json:"method"`
+	Content string `json:"content"`
+}
+
+func (p MCPOutputPolicy) maxTokens(toolName string) int {
+	if maxTokens, ok := p.ToolMaxTokens[toolName]; ok {
+		return max(maxTokens, 0)
+	}
+	return p.MaxTokens
+}
+
+// applyOutputPolicy shortens the content of response if it exceeds the size allowed for the tool.
+func (t *mcpFantasyTool) applyOutputPolicy(ctx context.Context, input string, response fantasy.ToolResponse) fantasy.ToolResponse {
+	policy := t.options.Output
+	maxTokens := policy.maxTokens(t.mcpName)
+	maxBytes := maxTokens * mcpOutputBytesPerToken
+	if maxBytes <= 0 || len(response.Content) <= maxBytes {
+		return response
+	}
+	original := response.Content
+
+	content, method := original, ""
+	if policy.MaxArrayItems > 0 {
+		if pruned, ok := pruneMCPOutputArrays(original, policy.MaxArrayItems); ok {
+			content, method = pruned, MCPOutputPruned
+		}
+	}
+	if len(content) > maxBytes && policy.SummaryModel != nil {
+		summary, err := t.summarizeOutput(ctx, input, content, maxTokens)
+		if err != nil {
+			log.Printf("failed to summarize output of tool %s: %v", t.toolInfo.Name, err)
+		} else {
+			content, method = summary, MCPOutputSummarized
+		}
+	}
+	if len(content) > maxBytes {
+		content, method = truncateMCPOutput(content, maxBytes), MCPOutputTruncated
+	}
+
+	response.Content = content
+	return withMCPResponseMetadata(response, MCPToolOriginalOutputMetadataKey, MCPOriginalOutput{Method: method, Content: original})
+}
+
+func (t *mcpFantasyTool) summarizeOutput(ctx context.Context, input, content string, maxTokens int) (string, error) {
+	policy := t.options.Output
+	summaryMaxTokens := policy.SummaryMaxTokens
+	if summaryMaxTokens <= 0 {
+		summaryMaxTokens = min(maxTokens, defaultMCPOutputSummaryMaxTokens)
+	}
+	inputMaxTokens := policy.SummaryInputMaxTokens
+	if inputMaxTokens <= 0 {
+		inputMaxTokens = defaultMCPOutputSummaryInputMaxTokens
+	}
+	size := len(content)
+	if inputMaxBytes := inputMaxTokens * mcpOutputBytesPerToken; len(content) > inputMaxBytes {
+		content = truncateMCPOutput(content, inputMaxBytes)
+	}
+
+	maxOutputTokens := int64(summaryMaxTokens)
+	resp, err := policy.SummaryModel.Generate(ctx, fantasy.Call{
+		Prompt: fantasy.Prompt{
+			fantasy.NewSystemMessage("You condense the output of tools for an AI agent that can't read it in full. " +
+				"Keep what the agent needs to act on: identifiers, names, numbers, dates, URLs, errors and warnings. " +
+				"Answer with the condensed output only."),
+			fantasy.NewUserMessage(fmt.Sprintf("Tool %s was called with arguments %s and returned:\n\n%s", t.toolInfo.Name, input, content)),
+		},
+		MaxOutputTokens: &maxOutputTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+	summary := resp.Content.Text()
+	if summary == "" {
+		return "", fmt.Errorf("model %s returned an empty summary", policy.SummaryModel.Model())
+	}
+	return fmt.Sprintf("[summary of %d bytes of output]\n%s", size, summary), nil
+}
+
+// pruneMCPOutputArrays drops the items of JSON arrays beyond the first maxItems, replacing them
+// with a note of how many were dropped. It reports false if content isn't JSON or has no array
+// to prune.
+func pruneMCPOutputArrays(content string, maxItems int) (string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(content)))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return "", false
+	}
+	value, pruned := pruneMCPOutputValue(value, maxItems)
+	if !pruned {
+		return "", false
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(encoded), true
+}
+
+func pruneMCPOutputValue(value any, maxItems int) (any, bool) {
+	pruned := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			var itemPruned bool
+			v[key], itemPruned = pruneMCPOutputValue(item, maxItems)
+			pruned = pruned || itemPruned
+		}
+	case []any:
+		if len(v) > maxItems {
+			dropped := len(v) - maxItems
+			v = append(v[:maxItems:maxItems], fmt.Sprintf("... %d more items", dropped))
+			pruned = true
+		}
+		for i, item := range v {
+			var itemPruned bool
+			v[i], itemPruned = pruneMCPOutputValue(item, maxItems)
+			pruned = pruned || itemPruned
+		}
+		return v, pruned
+	}
+	return value, pruned
+}
+
+// truncateMCPOutput keeps the head and tail of content within maxBytes, joined by a marker telling
+// how many bytes were left out. The head gets two thirds, as output usually leads with what matters.
+func truncateMCPOutput(content string, maxBytes int) string {
+	const marker = "\n\n[... %d bytes truncated ...]\n\n"
+	// the number of bytes left out has at most as many digits as the length of content
+	budget := maxBytes - len(fmt.Sprintf(marker, len(content)))
+	if budget <= 0 {
+		return fmt.Sprintf(marker, len(content))
+	}
+	headEnd := budget * 2 / 3
+	tailStart := len(content) - (budget - headEnd)
+	// cut at rune boundaries
+	for headEnd > 0 && !utf8.RuneStart(content[headEnd]) {
+		headEnd--
+	}
+	for tailStart < len(content) && !utf8.RuneStart(content[tailStart]) {
+		tailStart++
+	}
+	return content[:headEnd] + fmt.Sprintf(marker, tailStart-headEnd) + content[tailStart:]
+}
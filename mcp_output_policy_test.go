@@ -0,0 +1,145 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newVerboseMCPServer returns a server whose "tail_logs" tool returns 1000 lines of logs and whose
+// "list_builds" tool returns 200 builds as JSON.
+func newVerboseMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "ci", Version: "1.0.0"}, nil)
+	emptySchema := map[string]any{"type": "object"}
+	server.AddTool(&mcp.Tool{Name: "tail_logs", InputSchema: emptySchema}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var lines []string
+		for i := range 1000 {
+			lines = append(lines, fmt.Sprintf("line %04d: compiling package", i))
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: strings.Join(lines, "\n")}}}, nil
+	})
+	server.AddTool(&mcp.Tool{Name: "list_builds", InputSchema: emptySchema}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var builds []map[string]any
+		for i := range 200 {
+			builds = append(builds, map[string]any{"id": i, "status": "passed"})
+		}
+		encoded, _ := json.Marshal(map[string]any{"builds": builds, "total": 200})
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: string(encoded)}}}, nil
+	})
+	return server
+}
+
+func mcpToolOriginalOutput(t *testing.T, resp fantasy.ToolResponse) *MCPOriginalOutput {
+	t.Helper()
+	var metadata struct {
+		OriginalOutput *MCPOriginalOutput `json:"original_output"`
+	}
+	if resp.Metadata == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(resp.Metadata), &metadata); err != nil {
+		t.Fatalf("failed to decode metadata %q: %v", resp.Metadata, err)
+	}
+	return metadata.OriginalOutput
+}
+
+func TestMCPTools_OutputPolicy(t *testing.T) {
+	t.Parallel()
+	summaryModel := &fakeLanguageModel{name: "summary-model", reply: "1000 lines of compiling packages, no errors."}
+	tests := []struct {
+		name             string
+		tool             string
+		policy           MCPOutputPolicy
+		expectedMethod   string
+		expectedContains []string
+		expectedMaxBytes int
+	}{
+		{name: "within limits", tool: "tail_logs", policy: MCPOutputPolicy{MaxTokens: 100_000}},
+		{name: "truncated", tool: "tail_logs", policy: MCPOutputPolicy{MaxTokens: 250}, expectedMethod: MCPOutputTruncated,
+			expectedContains: []string{"line 0000", "bytes truncated", "line 0999"}, expectedMaxBytes: 1000},
+		{name: "tool limit", tool: "tail_logs", policy: MCPOutputPolicy{MaxTokens: 100_000, ToolMaxTokens: map[string]int{"tail_logs": 250}},
+			expectedMethod: MCPOutputTruncated, expectedMaxBytes: 1000},
+		{name: "tool without limit", tool: "tail_logs", policy: MCPOutputPolicy{MaxTokens: 250, ToolMaxTokens: map[string]int{"tail_logs": -1}}},
+		{name: "JSON pruned", tool: "list_builds", policy: MCPOutputPolicy{MaxTokens: 250, MaxArrayItems: 3}, expectedMethod: MCPOutputPruned,
+			expectedContains: []string{`{"id":2,"status":"passed"}`, `"... 197 more items"`, `"total":200`}, expectedMaxBytes: 1000},
+		{name: "summarized", tool: "tail_logs", policy: MCPOutputPolicy{MaxTokens: 250, SummaryModel: summaryModel}, expectedMethod: MCPOutputSummarized,
+			expectedContains: []string{"[summary of 28999 bytes of output]", "no errors."}, expectedMaxBytes: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			sessionMaker, _ := newTestMCPSessionMaker(t, newVerboseMCPServer(), nil)
+			tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{Output: tt.policy})
+
+			// When
+			resp, err := tools[tt.tool].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: tt.tool, Input: "{}"})
+
+			// Then
+			if err != nil || resp.IsError {
+				t.Fatalf("unexpected error: %v %+v", err, resp)
+			}
+			original := mcpToolOriginalOutput(t, resp)
+			if tt.expectedMethod == "" {
+				if original != nil {
+					t.Fatalf("expected output to be passed as is, got %s", original.Method)
+				}
+				return
+			}
+			if original == nil || original.Method != tt.expectedMethod {
+				t.Fatalf("expected output to be %s, got %+v", tt.expectedMethod, original)
+			}
+			if len(original.Content) <= len(resp.Content) {
+				t.Fatalf("expected the original output to be kept, got %d bytes", len(original.Content))
+			}
+			if len(resp.Content) > tt.expectedMaxBytes {
+				t.Fatalf("expected at most %d bytes, got %d", tt.expectedMaxBytes, len(resp.Content))
+			}
+			for _, expected := range tt.expectedContains {
+				if !strings.Contains(resp.Content, expected) {
+					t.Fatalf("expected output to contain %q, got %q", expected, resp.Content)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateMCPOutput(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		content  string
+		maxBytes int
+	}{
+		{name: "ascii", content: strings.Repeat("abcdefghij", 100), maxBytes: 200},
+		{name: "multi-byte runes", content: strings.Repeat("日本語のテキスト", 100), maxBytes: 200},
+		{name: "tiny limit", content: strings.Repeat("x", 100), maxBytes: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// When
+			truncated := truncateMCPOutput(tt.content, tt.maxBytes)
+
+			// Then
+			if !strings.Contains(truncated, "bytes truncated") {
+				t.Fatalf("expected a truncation marker, got %q", truncated)
+			}
+			if !utf8.ValidString(truncated) {
+				t.Fatalf("expected runes to be kept whole, got %q", truncated)
+			}
+			if head, _, _ := strings.Cut(truncated, "\n\n[..."); !strings.HasPrefix(tt.content, head) {
+				t.Fatalf("expected the head of the content to be kept, got %q", truncated)
+			}
+			if tt.maxBytes > 50 && len(truncated) > tt.maxBytes {
+				t.Fatalf("expected at most %d bytes, got %d", tt.maxBytes, len(truncated))
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newWeatherMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "weather", Version: "1.0.0"}, nil)
+	server.AddTool(&mcp.Tool{
+		Name:        "forecast",
+		InputSchema: map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+		OutputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"temperature": map[string]any{"$ref": "#/$defs/celsius"}},
+			"required":   []any{"temperature"},
+			"$defs":      map[string]any{"celsius": map[string]any{"type": "number"}},
+		},
+	}, func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if string(req.Params.Arguments) == `{"city":"Atlantis"}` {
+			return &mcp.CallToolResult{StructuredContent: map[string]any{"temperature": "unknown"}}, nil
+		}
+		return &mcp.CallToolResult{StructuredContent: map[string]any{"temperature": 21.5}}, nil
+	})
+	return server
+}
+
+func TestMCPTools_ValidatesStructuredContent(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, _ := newTestMCPSessionMaker(t, newWeatherMCPServer(), nil)
+	tools, err := MCPTools(context.Background(), sessionMaker)
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	tool, ok := tools[0].(MCPAgentTool)
+	if !ok {
+		t.Fatalf("expected an MCPAgentTool")
+	}
+	if tool.OutputSchema()["properties"].(map[string]any)["temperature"].(map[string]any)["type"] != "number" {
+		t.Fatalf("expected a resolved output schema: %v", tool.OutputSchema())
+	}
+
+	// When
+	resp, err := tool.Run(context.Background(), fantasy.ToolCall{Name: "forecast", Input: `{"city":"London"}`})
+	badResp, badErr := tool.Run(context.Background(), fantasy.ToolCall{Name: "forecast", Input: `{"city":"Atlantis"}`})
+
+	// Then
+	if err != nil || resp.IsError || resp.Type != "text" || resp.Content != `{"temperature":21.5}` {
+		t.Fatalf("unexpected response: %+v, %v", resp, err)
+	}
+	if badErr != nil || !badResp.IsError {
+		t.Fatalf("expected an error response: %+v, %v", badResp, badErr)
+	}
+	if !strings.HasPrefix(badResp.Content, "output of tool forecast does not match its output schema: ") || !strings.Contains(badResp.Content, `has type "string", want "number"`) {
+		t.Fatalf("unexpected content: %s", badResp.Content)
+	}
+	if !errors.Is(MCPToolResponseError(badResp), ErrMCPProtocol) {
+		t.Fatalf("expected a protocol error: %s", badResp.Metadata)
+	}
+}
@@ -0,0 +1,385 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ErrMCPSessionPoolClosed is returned when acquiring a session from a closed pool.
+var ErrMCPSessionPoolClosed = errors.New("MCP session pool is closed")
+
+const (
+	defaultMCPSessionPoolMaxIdle          = 2
+	defaultMCPSessionPoolMaxIdleTotal     = 16
+	defaultMCPSessionPoolHealthCheckAfter = 30 * time.Second
+	defaultMCPSessionPoolPingTimeout      = 5 * time.Second
+)
+
+type MCPSessionPoolOptions struct {
+	// MaxIdle is the number of idle sessions kept warm per key. Defaults to 2.
+	MaxIdle int
+	// MaxIdleTotal caps the number of idle sessions across all keys, closing the least recently
+	// used ones beyond it. Defaults to 16.
+	MaxIdleTotal int
+	// MaxActive caps the number of sessions in use at once across all keys.
+	// Acquire blocks until a session is released or the context is done. Zero means no limit.
+	MaxActive int
+	// IdleTimeout closes sessions that have been idle for longer than this, whether or not their key
+	// is used again. Zero means never.
+	IdleTimeout time.Duration
+	// HealthCheckAfter pings sessions that have been idle for longer than this before reusing them.
+	// Defaults to 30 seconds; a negative value disables health checks.
+	HealthCheckAfter time.Duration
+	// PingTimeout bounds each health check ping. Defaults to 5 seconds.
+	PingTimeout time.Duration
+	// KeyFunc derives an identity (e.g. the user behind an auth token) from the context.
+	// Sessions are only shared between callers with the same key. If nil, all callers share sessions.
+	KeyFunc func(context.Context) string
+}
+
+// MCPSessionPool keeps warm MCP sessions so that tool calls don't pay for an initialize
+// handshake (or a subprocess spawn) on every invocation.
+//
+// Sessions returned by the session maker must outlive the context they were created with.
+type MCPSessionPool struct {
+	sessionMaker MCPSessionMaker
+	options      MCPSessionPoolOptions
+	slots        chan struct{}
+
+	mu     sync.Mutex
+	idle   map[string][]*pooledMCPSession
+	active map[*mcp.ClientSession]*pooledMCPSession
+	closed bool
+	// reaping is set while a goroutine closes expired idle sessions; stop ends it
+	reaping bool
+	stop    chan struct{}
+}
+
+type pooledMCPSession struct {
+	session  *mcp.ClientSession
+	key      string
+	lastUsed time.Time
+	// done is closed once the session's connection is gone
+	done chan struct{}
+}
+
+func newPooledMCPSession(session *mcp.ClientSession, key string) *pooledMCPSession {
+	ps := &pooledMCPSession{session: session, key: key, done: make(chan struct{})}
+	go func() {
+		_ = session.Wait()
+		close(ps.done)
+	}()
+	return ps
+}
+
+// closed reports whether the session's connection is known to be gone.
+func (ps *pooledMCPSession) closed() bool {
+	select {
+	case <-ps.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func NewMCPSessionPool(sessionMaker MCPSessionMaker, options MCPSessionPoolOptions) *MCPSessionPool {
+	if options.MaxIdle <= 0 {
+		options.MaxIdle = defaultMCPSessionPoolMaxIdle
+	}
+	if options.MaxIdleTotal <= 0 {
+		options.MaxIdleTotal = defaultMCPSessionPoolMaxIdleTotal
+	}
+	if options.HealthCheckAfter == 0 {
+		options.HealthCheckAfter = defaultMCPSessionPoolHealthCheckAfter
+	}
+	if options.PingTimeout <= 0 {
+		options.PingTimeout = defaultMCPSessionPoolPingTimeout
+	}
+	var slots chan struct{}
+	if options.MaxActive > 0 {
+		slots = make(chan struct{}, options.MaxActive)
+	}
+	return &MCPSessionPool{
+		sessionMaker: sessionMaker,
+		options:      options,
+		slots:        slots,
+		idle:         make(map[string][]*pooledMCPSession),
+		active:       make(map[*mcp.ClientSession]*pooledMCPSession),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Acquire returns a session for the identity in ctx, reusing an idle one when possible.
+// Every acquired session must be handed back with Release.
+func (p *MCPSessionPool) Acquire(ctx context.Context) (*mcp.ClientSession, error) {
+	ps, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ps.session, nil
+}
+
+// Release hands a session back to the pool. callErr is the error (if any) encountered while
+// using the session; sessions that failed with a transport error are closed rather than reused.
+func (p *MCPSessionPool) Release(session *mcp.ClientSession, callErr error) {
+	p.mu.Lock()
+	ps, ok := p.active[session]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	p.release(ps, callErr)
+}
+
+// Close closes all idle sessions. Sessions still in use are closed when released.
+func (p *MCPSessionPool) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		close(p.stop)
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = make(map[string][]*pooledMCPSession)
+	p.mu.Unlock()
+
+	var errs []error
+	for _, sessions := range idle {
+		for _, ps := range sessions {
+			if err := ps.session.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// withSession runs fn with a session from the pool. Calls are never repeated here: once a request
+// may have reached the server, only the retry policy decides whether to send it again.
+func (p *MCPSessionPool) withSession(ctx context.Context, fn func(*mcp.ClientSession) error) error {
+	ps, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(ps.session)
+	p.release(ps, err)
+	return err
+}
+
+func (p *MCPSessionPool) acquire(ctx context.Context) (*pooledMCPSession, error) {
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	key := p.key(ctx)
+	for {
+		ps, err := p.popIdle(key)
+		if err != nil {
+			p.releaseSlot()
+			return nil, err
+		}
+		if ps == nil {
+			break
+		}
+		// sessions dropped while idle are replaced before any request is sent on them
+		if !ps.closed() && p.healthy(ctx, ps) {
+			p.markActive(ps)
+			return ps, nil
+		}
+		_ = ps.session.Close()
+	}
+
+	session, err := p.sessionMaker(ctx)
+	if err != nil {
+		p.releaseSlot()
+		return nil, fmt.Errorf("%w: %w", errMCPSessionCreation, err)
+	}
+	ps := newPooledMCPSession(session, key)
+	p.markActive(ps)
+	return ps, nil
+}
+
+func (p *MCPSessionPool) release(ps *pooledMCPSession, callErr error) {
+	defer p.releaseSlot()
+
+	p.mu.Lock()
+	delete(p.active, ps.session)
+	// the streamable transport also fails the connection on HTTP status errors
+	if p.closed || isMCPTransportError(callErr) || isMCPHTTPStatusError(callErr) || len(p.idle[ps.key]) >= p.options.MaxIdle {
+		p.mu.Unlock()
+		_ = ps.session.Close()
+		return
+	}
+	ps.lastUsed = time.Now()
+	p.idle[ps.key] = append(p.idle[ps.key], ps)
+	evicted := p.evictIdle()
+	if p.options.IdleTimeout > 0 && !p.reaping {
+		p.reaping = true
+		go p.reap()
+	}
+	p.mu.Unlock()
+	closeMCPSessions(evicted)
+}
+
+// evictIdle removes the least recently used idle sessions beyond MaxIdleTotal. p.mu must be held.
+func (p *MCPSessionPool) evictIdle() []*pooledMCPSession {
+	var evicted []*pooledMCPSession
+	for p.idleCount() > p.options.MaxIdleTotal {
+		var oldestKey string
+		var oldest *pooledMCPSession
+		for key, sessions := range p.idle {
+			// sessions are appended as they are released, so the first is the least recently used
+			if len(sessions) > 0 && (oldest == nil || sessions[0].lastUsed.Before(oldest.lastUsed)) {
+				oldestKey, oldest = key, sessions[0]
+			}
+		}
+		p.removeIdle(oldestKey, 0)
+		evicted = append(evicted, oldest)
+	}
+	return evicted
+}
+
+func (p *MCPSessionPool) idleCount() int {
+	n := 0
+	for _, sessions := range p.idle {
+		n += len(sessions)
+	}
+	return n
+}
+
+func (p *MCPSessionPool) removeIdle(key string, i int) {
+	sessions := slices.Delete(p.idle[key], i, i+1)
+	if len(sessions) == 0 {
+		delete(p.idle, key)
+		return
+	}
+	p.idle[key] = sessions
+}
+
+// reap closes idle sessions as they expire, for every key. It stops once no idle sessions are left
+// or the pool is closed.
+func (p *MCPSessionPool) reap() {
+	ticker := time.NewTicker(p.options.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		expired := p.expireIdle()
+		done := len(p.idle) == 0
+		if done {
+			p.reaping = false
+		}
+		p.mu.Unlock()
+		closeMCPSessions(expired)
+		if done {
+			return
+		}
+	}
+}
+
+// expireIdle removes idle sessions of every key that have outlived IdleTimeout. p.mu must be held.
+func (p *MCPSessionPool) expireIdle() []*pooledMCPSession {
+	if p.options.IdleTimeout <= 0 {
+		return nil
+	}
+	var expired []*pooledMCPSession
+	for key, sessions := range p.idle {
+		live := sessions[:0]
+		for _, ps := range sessions {
+			if time.Since(ps.lastUsed) > p.options.IdleTimeout {
+				expired = append(expired, ps)
+				continue
+			}
+			live = append(live, ps)
+		}
+		if len(live) == 0 {
+			delete(p.idle, key)
+			continue
+		}
+		p.idle[key] = live
+	}
+	return expired
+}
+
+func closeMCPSessions(sessions []*pooledMCPSession) {
+	for _, ps := range sessions {
+		_ = ps.session.Close()
+	}
+}
+
+// popIdle returns the most recently used idle session for key, closing any sessions that have
+// expired.
+func (p *MCPSessionPool) popIdle(key string) (*pooledMCPSession, error) {
+	var expired []*pooledMCPSession
+	defer func() { closeMCPSessions(expired) }()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrMCPSessionPoolClosed
+	}
+	expired = p.expireIdle()
+	sessions := p.idle[key]
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	ps := sessions[len(sessions)-1]
+	p.removeIdle(key, len(sessions)-1)
+	return ps, nil
+}
+
+func (p *MCPSessionPool) healthy(ctx context.Context, ps *pooledMCPSession) bool {
+	if p.options.HealthCheckAfter < 0 || time.Since(ps.lastUsed) < p.options.HealthCheckAfter {
+		return true
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, p.options.PingTimeout)
+	defer cancel()
+	return ps.session.Ping(pingCtx, nil) == nil
+}
+
+func (p *MCPSessionPool) markActive(ps *pooledMCPSession) {
+	p.mu.Lock()
+	p.active[ps.session] = ps
+	p.mu.Unlock()
+}
+
+func (p *MCPSessionPool) releaseSlot() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+func (p *MCPSessionPool) key(ctx context.Context) string {
+	if p.options.KeyFunc == nil {
+		return ""
+	}
+	return p.options.KeyFunc(ctx)
+}
+
+// isMCPTransportError reports whether err indicates the underlying connection is no longer usable.
+func isMCPTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *net.OpError
+	return errors.Is(err, mcp.ErrConnectionClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &opErr)
+}
@@ -0,0 +1,228 @@
+package fantasyextensions
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestMCPSessionPool_ReusesSessionsAcrossToolCalls(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, connections := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	pool := NewMCPSessionPool(sessionMaker, MCPSessionPoolOptions{})
+	defer pool.Close()
+	tools, err := MCPToolsWithOptions(context.Background(), sessionMaker, MCPToolsOptions{SessionPool: pool})
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+
+	// When
+	for range 3 {
+		resp, err := tools[0].Run(context.Background(), fantasy.ToolCall{Name: "echo", Input: `{"message": "hi"}`})
+		if err != nil {
+			t.Fatalf("failed to run tool: %v", err)
+		}
+		if resp.IsError || resp.Content != "hi" {
+			t.Fatalf("unexpected response: %+v", resp)
+		}
+	}
+
+	// Then
+	if got := connections.Load(); got != 1 {
+		t.Fatalf("expected 1 session to be created, got %d", got)
+	}
+}
+
+func TestMCPSessionPool_ReconnectsAfterSessionIsClosed(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, connections := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	pool := NewMCPSessionPool(sessionMaker, MCPSessionPoolOptions{HealthCheckAfter: -1})
+	defer pool.Close()
+	session, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire session: %v", err)
+	}
+	pool.Release(session, nil)
+	_ = session.Close()
+	// the pool notices the closed connection in the background
+	waitForClosedIdleMCPSession(t, pool)
+	tools, err := MCPToolsWithOptions(context.Background(), sessionMaker, MCPToolsOptions{SessionPool: pool})
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+
+	// When
+	resp, err := tools[0].Run(context.Background(), fantasy.ToolCall{Name: "echo", Input: `{"message": "hi"}`})
+
+	// Then
+	if err != nil || resp.IsError || resp.Content != "hi" {
+		t.Fatalf("unexpected response: %+v, %v", resp, err)
+	}
+	if got := connections.Load(); got != 2 {
+		t.Fatalf("expected 2 sessions to be created, got %d", got)
+	}
+}
+
+func TestMCPSessionPool_KeysSessionsByIdentity(t *testing.T) {
+	t.Parallel()
+	// Given
+	type identityKey struct{}
+	sessionMaker, connections := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	pool := NewMCPSessionPool(sessionMaker, MCPSessionPoolOptions{
+		KeyFunc: func(ctx context.Context) string {
+			identity, _ := ctx.Value(identityKey{}).(string)
+			return identity
+		},
+	})
+	defer pool.Close()
+
+	// When
+	for _, identity := range []string{"alice", "bob", "alice"} {
+		ctx := context.WithValue(context.Background(), identityKey{}, identity)
+		session, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatalf("failed to acquire session: %v", err)
+		}
+		pool.Release(session, nil)
+	}
+
+	// Then
+	if got := connections.Load(); got != 2 {
+		t.Fatalf("expected 2 sessions to be created, got %d", got)
+	}
+}
+
+func waitForClosedIdleMCPSession(t *testing.T, pool *MCPSessionPool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		pool.mu.Lock()
+		closed := len(pool.idle[""]) == 1 && pool.idle[""][0].closed()
+		pool.mu.Unlock()
+		if closed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected the pool to notice the closed session")
+}
+
+func TestMCPSessionPool_DoesNotRepeatCallsOnDroppedConnections(t *testing.T) {
+	t.Parallel()
+	// Given
+	var calls atomic.Int32
+	sessionMaker, _ := newTestMCPSessionMaker(t, newFlakyMCPServer(&calls), nil)
+	pool := NewMCPSessionPool(sessionMaker, MCPSessionPoolOptions{})
+	defer pool.Close()
+	tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{SessionPool: pool})
+	session, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire session: %v", err)
+	}
+	pool.Release(session, nil)
+
+	// When
+	resp, err := tools["charge"].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: "charge", Input: "{}"})
+
+	// Then
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.IsError {
+		t.Fatalf("expected the dropped call to fail, got %+v", resp)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected the server to be called once, got %d", got)
+	}
+}
+
+func TestMCPSessionPool_ClosesExpiredSessionsOfEveryKey(t *testing.T) {
+	t.Parallel()
+	// Given
+	type identityKey struct{}
+	sessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	pool := NewMCPSessionPool(sessionMaker, MCPSessionPoolOptions{
+		IdleTimeout: 50 * time.Millisecond,
+		KeyFunc: func(ctx context.Context) string {
+			identity, _ := ctx.Value(identityKey{}).(string)
+			return identity
+		},
+	})
+	defer pool.Close()
+	aliceCtx := context.WithValue(context.Background(), identityKey{}, "alice")
+	bobCtx := context.WithValue(context.Background(), identityKey{}, "bob")
+	alice, err := pool.Acquire(aliceCtx)
+	if err != nil {
+		t.Fatalf("failed to acquire session: %v", err)
+	}
+	pool.Release(alice, nil)
+
+	// When
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		bob, err := pool.Acquire(bobCtx)
+		if err != nil {
+			t.Fatalf("failed to acquire session: %v", err)
+		}
+		pool.Release(bob, nil)
+		pool.mu.Lock()
+		_, aliceIdle := pool.idle["alice"]
+		pool.mu.Unlock()
+		if !aliceIdle {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected alice's idle session to expire")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Then
+	if err := alice.Wait(); err != nil {
+		t.Fatalf("unexpected error waiting for the session: %v", err)
+	}
+}
+
+func TestMCPSessionPool_CapsIdleSessionsAcrossKeys(t *testing.T) {
+	t.Parallel()
+	// Given
+	type identityKey struct{}
+	sessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+	pool := NewMCPSessionPool(sessionMaker, MCPSessionPoolOptions{
+		MaxIdleTotal: 2,
+		KeyFunc: func(ctx context.Context) string {
+			identity, _ := ctx.Value(identityKey{}).(string)
+			return identity
+		},
+	})
+	defer pool.Close()
+
+	// When
+	var sessions []*mcp.ClientSession
+	for _, identity := range []string{"alice", "bob", "carol"} {
+		session, err := pool.Acquire(context.WithValue(context.Background(), identityKey{}, identity))
+		if err != nil {
+			t.Fatalf("failed to acquire session: %v", err)
+		}
+		pool.Release(session, nil)
+		sessions = append(sessions, session)
+	}
+
+	// Then
+	pool.mu.Lock()
+	_, aliceIdle := pool.idle["alice"]
+	idle := pool.idleCount()
+	pool.mu.Unlock()
+	if aliceIdle || idle != 2 {
+		t.Fatalf("expected the least recently used session to be closed, got %d idle", idle)
+	}
+	if err := sessions[0].Wait(); err != nil {
+		t.Fatalf("unexpected error waiting for the session: %v", err)
+	}
+}
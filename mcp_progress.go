@@ -0,0 +1,101 @@
+package fantasyextensions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCPProgress reports how far along a long-running MCP tool call is.
+type MCPProgress struct {
+	ToolCallID string  `json:"tool_call_id"`
+	ToolName   string  `json:"tool_name"`
+	Progress   float64 `json:"progress"`
+	// Total is zero when the server doesn't know how much work remains.
+	Total   float64 `json:"total,omitempty"`
+	Message string  `json:"message,omitempty"`
+}
+
+// MCPProgressFunc receives progress of MCP tool calls. It is called on the session's notification
+// goroutine and should return quickly.
+type MCPProgressFunc func(ctx context.Context, progress MCPProgress)
+
+type mcpProgressContextKey struct{}
+
+// WithMCPProgress returns a context that makes MCP tool calls request progress notifications and
+// deliver them to fn. AGUIHandler installs one that emits AG-UI events.
+//
+// Notifications are only delivered if the client used by the session maker is configured with
+// MCPProgressNotificationHandler:
+//
+//	client := mcp.NewClient(impl, &mcp.ClientOptions{
+//		ProgressNotificationHandler: fantasyextensions.MCPProgressNotificationHandler,
+//	})
+func WithMCPProgress(ctx context.Context, fn MCPProgressFunc) context.Context {
+	return context.WithValue(ctx, mcpProgressContextKey{}, fn)
+}
+
+func mcpProgressFromContext(ctx context.Context) (MCPProgressFunc, bool) {
+	fn, ok := ctx.Value(mcpProgressContextKey{}).(MCPProgressFunc)
+	return fn, ok && fn != nil
+}
+
+// mcpProgressListener routes notifications for one in-flight call back to its callback.
+type mcpProgressListener struct {
+	ctx        context.Context
+	fn         MCPProgressFunc
+	toolCallID string
+	toolName   string
+}
+
+var (
+	mcpProgressListenersMu sync.Mutex
+	mcpProgressListeners   = map[string]*mcpProgressListener{}
+)
+
+// MCPProgressNotificationHandler delivers progress notifications to the MCPProgressFunc of the call
+// they belong to. Use it as mcp.ClientOptions.ProgressNotificationHandler.
+func MCPProgressNotificationHandler(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+	if req.Params == nil {
+		return
+	}
+	mcpProgressListenersMu.Lock()
+	listener, ok := mcpProgressListeners[fmt.Sprint(req.Params.ProgressToken)]
+	mcpProgressListenersMu.Unlock()
+	if !ok {
+		return
+	}
+	listener.fn(listener.ctx, MCPProgress{
+		ToolCallID: listener.toolCallID,
+		ToolName:   listener.toolName,
+		Progress:   req.Params.Progress,
+		Total:      req.Params.Total,
+		Message:    req.Params.Message,
+	})
+}
+
+// trackMCPProgress attaches a progress token to params if ctx carries an MCPProgressFunc.
+// The returned func stops delivering notifications and must be called once the call completes.
+func trackMCPProgress(ctx context.Context, params *mcp.CallToolParams, toolCallID, toolName string) func() {
+	fn, ok := mcpProgressFromContext(ctx)
+	if !ok {
+		return func() {}
+	}
+	token := uuid.NewString()
+	mcpProgressListenersMu.Lock()
+	mcpProgressListeners[token] = &mcpProgressListener{ctx: ctx, fn: fn, toolCallID: toolCallID, toolName: toolName}
+	mcpProgressListenersMu.Unlock()
+	if params.Meta == nil {
+		// SetProgressToken drops the token when Meta is nil
+		params.Meta = mcp.Meta{}
+	}
+	params.SetProgressToken(token)
+	return func() {
+		mcpProgressListenersMu.Lock()
+		delete(mcpProgressListeners, token)
+		mcpProgressListenersMu.Unlock()
+	}
+}
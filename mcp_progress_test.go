@@ -0,0 +1,130 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newIndexingMCPServer(steps int) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "indexer", Version: "1.0.0"}, nil)
+	server.AddTool(&mcp.Tool{Name: "index", InputSchema: map[string]any{"type": "object"}}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		token := req.Params.GetProgressToken()
+		for i := 1; token != nil && i <= steps; i++ {
+			_ = req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+				ProgressToken: token,
+				Progress:      float64(i),
+				Total:         float64(steps),
+				Message:       "indexing",
+			})
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "indexed"}}}, nil
+	})
+	return server
+}
+
+func newProgressMCPSessionMaker(t *testing.T, steps int) MCPSessionMaker {
+	t.Helper()
+	sessionMaker, _ := newTestMCPSessionMaker(t, newIndexingMCPServer(steps), &mcp.ClientOptions{
+		ProgressNotificationHandler: MCPProgressNotificationHandler,
+	})
+	return sessionMaker
+}
+
+func TestMCPTools_Progress(t *testing.T) {
+	t.Parallel()
+	// Given
+	tools := mcpToolsByName(t, newProgressMCPSessionMaker(t, 3), MCPToolsOptions{})
+	var mu sync.Mutex
+	var received []MCPProgress
+	ctx := WithMCPProgress(context.Background(), func(_ context.Context, progress MCPProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, progress)
+	})
+
+	// When
+	resp, err := tools["index"].Run(ctx, fantasy.ToolCall{ID: "call-1", Name: "index", Input: "{}"})
+
+	// Then
+	if err != nil || resp.IsError {
+		t.Fatalf("unexpected failure: %v %s", err, resp.Content)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 {
+		t.Fatalf("expected 3 progress notifications, got %d", len(received))
+	}
+	last := received[2]
+	expected := MCPProgress{ToolCallID: "call-1", ToolName: "index", Progress: 3, Total: 3, Message: "indexing"}
+	if last != expected {
+		t.Fatalf("expected %+v, got %+v", expected, last)
+	}
+}
+
+func TestMCPTools_ProgressListenerRemovedAfterCall(t *testing.T) {
+	t.Parallel()
+	// Given
+	tools := mcpToolsByName(t, newProgressMCPSessionMaker(t, 3), MCPToolsOptions{})
+	ctx := WithMCPProgress(context.Background(), func(context.Context, MCPProgress) {})
+
+	// When
+	resp, err := tools["index"].Run(ctx, fantasy.ToolCall{ID: "call-removed", Name: "index", Input: "{}"})
+
+	// Then
+	if err != nil || resp.IsError {
+		t.Fatalf("unexpected failure: %v %s", err, resp.Content)
+	}
+	mcpProgressListenersMu.Lock()
+	defer mcpProgressListenersMu.Unlock()
+	for _, listener := range mcpProgressListeners {
+		if listener.toolCallID == "call-removed" {
+			t.Fatalf("expected no progress listener to remain registered")
+		}
+	}
+}
+
+func TestAGUIRun_EmitsToolProgress(t *testing.T) {
+	t.Parallel()
+	// Given
+	tools := mcpToolsByName(t, newProgressMCPSessionMaker(t, 2), MCPToolsOptions{})
+	recorder := httptest.NewRecorder()
+	run := &aguiRun{threadID: "thread-1", runID: "run-1", writer: newStreamWriter(recorder)}
+	ctx := WithMCPProgress(context.WithValue(context.Background(), aguiRunContextKey{}, run), run.emitToolProgress)
+
+	// When
+	if _, err := tools["index"].Run(ctx, fantasy.ToolCall{ID: "call-7", Name: "index", Input: "{}"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Then
+	var progress []MCPProgress
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Name  string      `json:"name"`
+			Value MCPProgress `json:"value"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("failed to decode event: %v", err)
+		}
+		if event.Name == AGUIToolProgressEventName {
+			progress = append(progress, event.Value)
+		}
+	}
+	if len(progress) != 2 {
+		t.Fatalf("expected 2 progress events, got %d: %s", len(progress), recorder.Body.String())
+	}
+	if progress[1].ToolCallID != "call-7" || progress[1].Progress != 2 || progress[1].Total != 2 {
+		t.Fatalf("unexpected progress event: %+v", progress[1])
+	}
+}
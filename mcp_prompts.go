@@ -0,0 +1,174 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCPPromptArguments resolves the arguments of an MCP prompt for a run.
+type MCPPromptArguments func(ctx context.Context) map[string]string
+
+// MCPPromptArgumentsFromState resolves the arguments prompt declares from the top level fields of
+// the AG-UI state carried in the context under AgentContextStateKey. Other fields of the state are
+// never sent to the server. Strings are used as is; other values are JSON encoded.
+func MCPPromptArgumentsFromState(prompt *mcp.Prompt) MCPPromptArguments {
+	return func(ctx context.Context) map[string]string {
+		state, ok := ctx.Value(AgentContextStateKey).(map[string]any)
+		if !ok {
+			return nil
+		}
+		arguments := make(map[string]string, len(prompt.Arguments))
+		for _, argument := range prompt.Arguments {
+			switch value := state[argument.Name].(type) {
+			case nil:
+				continue
+			case string:
+				arguments[argument.Name] = value
+			default:
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					continue
+				}
+				arguments[argument.Name] = string(encoded)
+			}
+		}
+		return arguments
+	}
+}
+
+// ListMCPPrompts returns the prompts published by an MCP server.
+func ListMCPPrompts(ctx context.Context, sessionMaker MCPSessionMaker) ([]*mcp.Prompt, error) {
+	sessions := newMCPSessionProvider(sessionMaker, MCPToolsOptions{})
+	var prompts []*mcp.Prompt
+	err := sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+		for prompt, err := range session.Prompts(ctx, nil) {
+			if err != nil {
+				return err
+			}
+			prompts = append(prompts, prompt)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prompts, nil
+}
+
+// MCPPromptSystemPrompt returns a SystemPromptGenerator that fetches the named MCP prompt for every
+// run and joins the text of its messages. arguments may be nil. Failures are logged and yield an
+// empty prompt.
+func MCPPromptSystemPrompt(sessionMaker MCPSessionMaker, name string, arguments MCPPromptArguments) SystemPromptGenerator {
+	return func(ctx context.Context) string {
+		var args map[string]string
+		if arguments != nil {
+			args = arguments(ctx)
+		}
+		result, err := getMCPPrompt(ctx, sessionMaker, name, args)
+		if err != nil {
+			log.Printf("failed to get MCP prompt %s for the system prompt: %v", name, err)
+			return ""
+		}
+		texts := make([]string, 0, len(result.Messages))
+		for _, message := range result.Messages {
+			if text := mcpPromptText(message.Content); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "\n\n")
+	}
+}
+
+// MCPPromptMessages fetches the named MCP prompt and converts it into messages to start a
+// conversation with. Images and audio become file parts of user messages; in assistant
+// messages they are replaced with a placeholder.
+func MCPPromptMessages(ctx context.Context, sessionMaker MCPSessionMaker, name string, arguments map[string]string) ([]fantasy.Message, error) {
+	result, err := getMCPPrompt(ctx, sessionMaker, name, arguments)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]fantasy.Message, 0, len(result.Messages))
+	for _, message := range result.Messages {
+		role := fantasy.MessageRoleUser
+		if message.Role == "assistant" {
+			role = fantasy.MessageRoleAssistant
+		}
+		part, err := mcpPromptMessagePart(message.Content, role)
+		if err != nil {
+			return nil, fmt.Errorf("prompt %s: %w", name, err)
+		}
+		messages = appendMCPMessagePart(messages, role, part)
+	}
+	return messages, nil
+}
+
+// appendMCPMessagePart adds part to messages, merging consecutive parts from the same role, as some
+// providers require alternating roles.
+func appendMCPMessagePart(messages []fantasy.Message, role fantasy.MessageRole, part fantasy.MessagePart) []fantasy.Message {
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, part)
+		return messages
+	}
+	return append(messages, fantasy.Message{Role: role, Content: []fantasy.MessagePart{part}})
+}
+
+func getMCPPrompt(ctx context.Context, sessionMaker MCPSessionMaker, name string, arguments map[string]string) (*mcp.GetPromptResult, error) {
+	sessions := newMCPSessionProvider(sessionMaker, MCPToolsOptions{})
+	var result *mcp.GetPromptResult
+	err := sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+		var err error
+		result, err = session.GetPrompt(ctx, &mcp.GetPromptParams{Name: name, Arguments: arguments})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func mcpPromptMessagePart(content mcp.Content, role fantasy.MessageRole) (fantasy.MessagePart, error) {
+	switch c := content.(type) {
+	case *mcp.ImageContent:
+		if role == fantasy.MessageRoleUser {
+			return fantasy.FilePart{Data: c.Data, MediaType: c.MIMEType}, nil
+		}
+	case *mcp.AudioContent:
+		if role == fantasy.MessageRoleUser {
+			return fantasy.FilePart{Data: c.Data, MediaType: c.MIMEType}, nil
+		}
+	case *mcp.EmbeddedResource:
+		if c.Resource != nil && c.Resource.Blob != nil && role == fantasy.MessageRoleUser {
+			return fantasy.FilePart{Filename: c.Resource.URI, Data: c.Resource.Blob, MediaType: c.Resource.MIMEType}, nil
+		}
+	case nil:
+		return nil, fmt.Errorf("message without content")
+	}
+	return fantasy.TextPart{Text: mcpPromptText(content)}, nil
+}
+
+// mcpPromptText renders prompt content as text, with placeholders for binary content.
+func mcpPromptText(content mcp.Content) string {
+	switch c := content.(type) {
+	case *mcp.TextContent:
+		return c.Text
+	case *mcp.ImageContent:
+		return fmt.Sprintf("[image: %s, %d bytes]", c.MIMEType, len(c.Data))
+	case *mcp.AudioContent:
+		return fmt.Sprintf("[audio: %s, %d bytes]", c.MIMEType, len(c.Data))
+	case *mcp.EmbeddedResource:
+		output := &mcpToolOutput{}
+		if c.Resource != nil {
+			output.addResource(c.Resource)
+		}
+		return strings.Join(output.text, "\n")
+	case *mcp.ResourceLink:
+		return formatMCPResourceLink(c)
+	}
+	return ""
+}
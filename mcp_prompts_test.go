@@ -0,0 +1,122 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newPromptsMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "prompts", Version: "1.0.0"}, nil)
+	server.AddPrompt(&mcp.Prompt{
+		Name:      "code_review",
+		Arguments: []*mcp.PromptArgument{{Name: "language", Required: true}},
+	}, func(_ context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		language, ok := req.Params.Arguments["language"]
+		if !ok {
+			return nil, errors.New("missing argument: language")
+		}
+		if len(req.Params.Arguments) != 1 {
+			return nil, fmt.Errorf("unexpected arguments: %v", req.Params.Arguments)
+		}
+		return &mcp.GetPromptResult{Messages: []*mcp.PromptMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: "You review " + language + " code."}},
+			{Role: "user", Content: &mcp.ImageContent{Data: []byte("png"), MIMEType: "image/png"}},
+			{Role: "assistant", Content: &mcp.TextContent{Text: "Send me the diff."}},
+		}}, nil
+	})
+	return server
+}
+
+func TestListMCPPrompts(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, _ := newTestMCPSessionMaker(t, newPromptsMCPServer(), nil)
+
+	// When
+	prompts, err := ListMCPPrompts(context.Background(), sessionMaker)
+
+	// Then
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(prompts) != 1 || prompts[0].Name != "code_review" {
+		t.Fatalf("expected the code_review prompt, got %v", prompts)
+	}
+}
+
+func TestMCPPromptSystemPrompt(t *testing.T) {
+	t.Parallel()
+	sessionMaker, _ := newTestMCPSessionMaker(t, newPromptsMCPServer(), nil)
+	prompts, err := ListMCPPrompts(context.Background(), sessionMaker)
+	if err != nil {
+		t.Fatalf("failed to list prompts: %v", err)
+	}
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{
+			name:     "arguments from AG-UI state",
+			ctx:      context.WithValue(context.Background(), AgentContextStateKey, map[string]any{"language": "Go"}),
+			expected: "You review Go code.\n\n[image: image/png, 3 bytes]\n\nSend me the diff.",
+		},
+		{
+			name:     "undeclared state is not sent",
+			ctx:      context.WithValue(context.Background(), AgentContextStateKey, map[string]any{"language": "Go", "auth_token": "secret", "cart": []any{"book"}}),
+			expected: "You review Go code.\n\n[image: image/png, 3 bytes]\n\nSend me the diff.",
+		},
+		{
+			name:     "missing required arguments",
+			ctx:      context.Background(),
+			expected: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			spg := MCPPromptSystemPrompt(sessionMaker, "code_review", MCPPromptArgumentsFromState(prompts[0]))
+
+			// When
+			prompt := spg(tt.ctx)
+
+			// Then
+			if prompt != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, prompt)
+			}
+		})
+	}
+}
+
+func TestMCPPromptMessages(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, _ := newTestMCPSessionMaker(t, newPromptsMCPServer(), nil)
+
+	// When
+	messages, err := MCPPromptMessages(context.Background(), sessionMaker, "code_review", map[string]string{"language": "Rust"})
+
+	// Then
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []fantasy.Message{
+		{Role: fantasy.MessageRoleUser, Content: []fantasy.MessagePart{
+			fantasy.TextPart{Text: "You review Rust code."},
+			fantasy.FilePart{Data: []byte("png"), MediaType: "image/png"},
+		}},
+		{Role: fantasy.MessageRoleAssistant, Content: []fantasy.MessagePart{
+			fantasy.TextPart{Text: "Send me the diff."},
+		}},
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, messages)
+	}
+}
@@ -0,0 +1,222 @@
+package fantasyextensions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/yosida95/uritemplate/v3"
+)
+
+type MCPResourceToolsOptions struct {
+	// SessionPool, when set, is used to obtain sessions instead of calling the session maker
+	// (and closing the session) for every tool call.
+	SessionPool *MCPSessionPool
+	// NamePrefix is prepended to the tool names, to tell apart the resources of several servers.
+	NamePrefix string
+	// Media controls how binary resource contents are handled.
+	Media MCPMediaOptions
+}
+
+// MCPResourceTools returns list_resources, list_resource_templates and read_resource tools
+// through which an agent can browse and read the resources published by an MCP server.
+// It returns no tools if the server doesn't support resources.
+func MCPResourceTools(ctx context.Context, sessionMaker MCPSessionMaker) ([]fantasy.AgentTool, error) {
+	return MCPResourceToolsWithOptions(ctx, sessionMaker, MCPResourceToolsOptions{})
+}
+
+func MCPResourceToolsWithOptions(ctx context.Context, sessionMaker MCPSessionMaker, options MCPResourceToolsOptions) ([]fantasy.AgentTool, error) {
+	sessions := newMCPSessionProvider(sessionMaker, MCPToolsOptions{SessionPool: options.SessionPool})
+	var supported bool
+	err := sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+		initializeResult := session.InitializeResult()
+		supported = initializeResult != nil && initializeResult.Capabilities != nil && initializeResult.Capabilities.Resources != nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		return []fantasy.AgentTool{}, nil
+	}
+	r := &mcpResourceTools{sessions: sessions, options: options}
+	return []fantasy.AgentTool{
+		fantasy.NewAgentTool(options.NamePrefix+"list_resources",
+			"List the resources (documents, files, records) available to read with "+options.NamePrefix+"read_resource.",
+			r.listResources),
+		fantasy.NewAgentTool(options.NamePrefix+"list_resource_templates",
+			"List templates of resource URIs that can be filled in with arguments and read with "+options.NamePrefix+"read_resource.",
+			r.listResourceTemplates),
+		fantasy.NewAgentTool(options.NamePrefix+"read_resource",
+			"Read a resource by URI. For a resource template, pass the template as the uri and the values of its variables as arguments.",
+			r.readResource),
+	}, nil
+}
+
+type mcpResourceTools struct {
+	sessions mcpSessionProvider
+	options  MCPResourceToolsOptions
+}
+
+type mcpListResourcesInput struct {
+	Cursor string `json:"cursor,omitempty" description:"The next_cursor returned by a previous call, to fetch the next page"`
+}
+
+type mcpReadResourceInput struct {
+	URI       string            `json:"uri" description:"The URI of the resource, or a URI template"`
+	Arguments map[string]string `json:"arguments,omitempty" description:"Values for the variables of a URI template"`
+}
+
+func (r *mcpResourceTools) listResources(ctx context.Context, input mcpListResourcesInput, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	var result *mcp.ListResourcesResult
+	err := r.sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+		var err error
+		result, err = session.ListResources(ctx, &mcp.ListResourcesParams{Cursor: input.Cursor})
+		return err
+	})
+	if err != nil {
+		return mcpToolErrorResponse(classifyMCPCallError(ctx, call.Name, err)), nil
+	}
+	if len(result.Resources) == 0 {
+		return fantasy.NewTextResponse("no resources available"), nil
+	}
+	lines := make([]string, 0, len(result.Resources)+1)
+	for _, resource := range result.Resources {
+		lines = append(lines, "- "+formatMCPResource(resource.URI, resource.Name, resource.Title, resource.MIMEType, resource.Description))
+	}
+	if result.NextCursor != "" {
+		lines = append(lines, "next_cursor: "+result.NextCursor)
+	}
+	return fantasy.NewTextResponse(strings.Join(lines, "\n")), nil
+}
+
+func (r *mcpResourceTools) listResourceTemplates(ctx context.Context, input mcpListResourcesInput, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	var result *mcp.ListResourceTemplatesResult
+	err := r.sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+		var err error
+		result, err = session.ListResourceTemplates(ctx, &mcp.ListResourceTemplatesParams{Cursor: input.Cursor})
+		return err
+	})
+	if err != nil {
+		return mcpToolErrorResponse(classifyMCPCallError(ctx, call.Name, err)), nil
+	}
+	if len(result.ResourceTemplates) == 0 {
+		return fantasy.NewTextResponse("no resource templates available"), nil
+	}
+	lines := make([]string, 0, len(result.ResourceTemplates)+1)
+	for _, template := range result.ResourceTemplates {
+		lines = append(lines, "- "+formatMCPResource(template.URITemplate, template.Name, template.Title, template.MIMEType, template.Description))
+	}
+	if result.NextCursor != "" {
+		lines = append(lines, "next_cursor: "+result.NextCursor)
+	}
+	return fantasy.NewTextResponse(strings.Join(lines, "\n")), nil
+}
+
+func (r *mcpResourceTools) readResource(ctx context.Context, input mcpReadResourceInput, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	uri, err := expandMCPResourceURI(input.URI, input.Arguments)
+	if err != nil {
+		return mcpToolErrorResponse(&MCPToolError{Kind: MCPToolErrorInvalidArguments, ToolName: call.Name, Message: err.Error(), err: err}), nil
+	}
+	var result *mcp.ReadResourceResult
+	err = r.sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+		var err error
+		result, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+		return err
+	})
+	if err != nil {
+		return mcpToolErrorResponse(classifyMCPCallError(ctx, call.Name, err)), nil
+	}
+	if len(result.Contents) == 0 {
+		return mcpToolErrorResponse(&MCPToolError{Kind: MCPToolErrorProtocol, ToolName: call.Name, Message: "no contents returned for resource " + uri}), nil
+	}
+	output := &mcpToolOutput{mediaOptions: r.options.Media}
+	for _, contents := range result.Contents {
+		output.addResource(contents)
+	}
+	return output.response(), nil
+}
+
+// expandMCPResourceURI fills in the variables of a URI template. Plain URIs are returned as is.
+func expandMCPResourceURI(uri string, arguments map[string]string) (string, error) {
+	if !strings.Contains(uri, "{") {
+		return uri, nil
+	}
+	template, err := uritemplate.New(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid URI template %s: %w", uri, err)
+	}
+	values := uritemplate.Values{}
+	var missing []string
+	for _, name := range template.Varnames() {
+		value, ok := arguments[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		values.Set(name, uritemplate.String(value))
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing arguments for URI template %s: %s", uri, strings.Join(missing, ", "))
+	}
+	return template.Expand(values)
+}
+
+func formatMCPResource(uri, name, title, mimeType, description string) string {
+	details := []string{}
+	if title != "" {
+		details = append(details, title)
+	} else if name != "" {
+		details = append(details, name)
+	}
+	if mimeType != "" {
+		details = append(details, mimeType)
+	}
+	text := uri
+	if len(details) > 0 {
+		text += " (" + strings.Join(details, ", ") + ")"
+	}
+	if description != "" {
+		text += ": " + description
+	}
+	return text
+}
+
+// MCPResourcesSystemPrompt extends the system prompt produced by spg (if any) with the contents of
+// the given resources, read afresh every time the prompt is generated. Resources that can't be read
+// are logged and left out. Binary contents are not included.
+func MCPResourcesSystemPrompt(spg SystemPromptGenerator, sessionMaker MCPSessionMaker, uris ...string) SystemPromptGenerator {
+	sessions := newMCPSessionProvider(sessionMaker, MCPToolsOptions{})
+	return func(ctx context.Context) string {
+		var prompt strings.Builder
+		if spg != nil {
+			prompt.WriteString(spg(ctx))
+		}
+		err := sessions.withSession(ctx, func(session *mcp.ClientSession) error {
+			for _, uri := range uris {
+				result, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+				if err != nil {
+					log.Printf("failed to read MCP resource %s for the system prompt: %v", uri, err)
+					continue
+				}
+				for _, contents := range result.Contents {
+					if contents.Blob != nil {
+						continue
+					}
+					if prompt.Len() > 0 {
+						prompt.WriteString("\n\n")
+					}
+					fmt.Fprintf(&prompt, "<resource uri=%q>\n%s\n</resource>", contents.URI, contents.Text)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("failed to read MCP resources for the system prompt: %v", err)
+		}
+		return prompt.String()
+	}
+}
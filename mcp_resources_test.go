@@ -0,0 +1,162 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newHandbookMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "handbook", Version: "1.0.0"}, &mcp.ServerOptions{PageSize: 2})
+	docs := map[string]string{
+		"docs://intro":   "Welcome to the project.",
+		"docs://install": "Run go get.",
+		"docs://faq":     "Ask away.",
+	}
+	for uri, text := range docs {
+		server.AddResource(&mcp.Resource{URI: uri, Name: strings.TrimPrefix(uri, "docs://"), MIMEType: "text/markdown"}, func(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{URI: req.Params.URI, MIMEType: "text/markdown", Text: text}}}, nil
+		})
+	}
+	server.AddResourceTemplate(&mcp.ResourceTemplate{URITemplate: "users://{id}/profile", Name: "user profile"}, func(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{URI: req.Params.URI, Text: "profile of " + req.Params.URI}}}, nil
+	})
+	return server
+}
+
+func runMCPResourceTool(t *testing.T, tools map[string]fantasy.AgentTool, name string, input any) fantasy.ToolResponse {
+	t.Helper()
+	b, err := json.Marshal(input)
+	if err != nil {
+		t.Fatalf("failed to encode input: %v", err)
+	}
+	resp, err := tools[name].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: name, Input: string(b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return resp
+}
+
+func TestMCPResourceTools_ListsResourcesPageByPage(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, _ := newTestMCPSessionMaker(t, newHandbookMCPServer(), nil)
+	tools, err := MCPResourceTools(context.Background(), sessionMaker)
+	if err != nil {
+		t.Fatalf("failed to create resource tools: %v", err)
+	}
+	toolsByName := map[string]fantasy.AgentTool{}
+	for _, tool := range tools {
+		toolsByName[tool.Info().Name] = tool
+	}
+
+	// When
+	var listed []string
+	cursor := ""
+	for range 3 {
+		resp := runMCPResourceTool(t, toolsByName, "list_resources", map[string]any{"cursor": cursor})
+		if resp.IsError {
+			t.Fatalf("unexpected error response: %s", resp.Content)
+		}
+		listed = append(listed, regexp.MustCompile(`docs://\w+`).FindAllString(resp.Content, -1)...)
+		next := regexp.MustCompile(`next_cursor: (\S+)`).FindStringSubmatch(resp.Content)
+		if next == nil {
+			break
+		}
+		cursor = next[1]
+	}
+
+	// Then
+	if len(listed) != 3 {
+		t.Fatalf("expected all 3 resources across pages, got %v", listed)
+	}
+}
+
+func TestMCPResourceTools(t *testing.T) {
+	t.Parallel()
+	sessionMaker, _ := newTestMCPSessionMaker(t, newHandbookMCPServer(), nil)
+	tools, err := MCPResourceToolsWithOptions(context.Background(), sessionMaker, MCPResourceToolsOptions{NamePrefix: "docs_"})
+	if err != nil {
+		t.Fatalf("failed to create resource tools: %v", err)
+	}
+	toolsByName := map[string]fantasy.AgentTool{}
+	for _, tool := range tools {
+		toolsByName[tool.Info().Name] = tool
+	}
+
+	tests := []struct {
+		name             string
+		tool             string
+		input            any
+		expectedContent  string
+		expectedSentinel error
+	}{
+		{name: "list templates", tool: "docs_list_resource_templates", input: map[string]any{}, expectedContent: "users://{id}/profile (user profile)"},
+		{name: "read resource", tool: "docs_read_resource", input: map[string]any{"uri": "docs://intro"}, expectedContent: "[resource: docs://intro (text/markdown)]\nWelcome to the project."},
+		{name: "read template", tool: "docs_read_resource", input: map[string]any{"uri": "users://{id}/profile", "arguments": map[string]string{"id": "42"}}, expectedContent: "profile of users://42/profile"},
+		{name: "template arguments missing", tool: "docs_read_resource", input: map[string]any{"uri": "users://{id}/profile"}, expectedSentinel: ErrMCPInvalidArguments},
+		{name: "unknown resource", tool: "docs_read_resource", input: map[string]any{"uri": "docs://missing"}, expectedSentinel: ErrMCPProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// When
+			resp := runMCPResourceTool(t, toolsByName, tt.tool, tt.input)
+
+			// Then
+			if tt.expectedSentinel != nil {
+				if !errors.Is(MCPToolResponseError(resp), tt.expectedSentinel) {
+					t.Fatalf("expected %v, got %v: %s", tt.expectedSentinel, MCPToolResponseError(resp), resp.Content)
+				}
+				return
+			}
+			if resp.IsError {
+				t.Fatalf("unexpected error response: %s", resp.Content)
+			}
+			if !strings.Contains(resp.Content, tt.expectedContent) {
+				t.Fatalf("expected %q in %q", tt.expectedContent, resp.Content)
+			}
+		})
+	}
+}
+
+func TestMCPResourceTools_ServerWithoutResources(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, _ := newTestMCPSessionMaker(t, newEchoMCPServer(), nil)
+
+	// When
+	tools, err := MCPResourceTools(context.Background(), sessionMaker)
+
+	// Then
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tools) != 0 {
+		t.Fatalf("expected no tools, got %d", len(tools))
+	}
+}
+
+func TestMCPResourcesSystemPrompt(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, _ := newTestMCPSessionMaker(t, newHandbookMCPServer(), nil)
+	spg := MCPResourcesSystemPrompt(func(context.Context) string { return "You are a helpful assistant." }, sessionMaker, "docs://intro", "docs://missing", "docs://faq")
+
+	// When
+	prompt := spg(context.Background())
+
+	// Then
+	expected := "You are a helpful assistant.\n\n" +
+		"<resource uri=\"docs://intro\">\nWelcome to the project.\n</resource>\n\n" +
+		"<resource uri=\"docs://faq\">\nAsk away.\n</resource>"
+	if prompt != expected {
+		t.Fatalf("expected %q, got %q", expected, prompt)
+	}
+}
@@ -0,0 +1,222 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MCPToolAttemptsMetadataKey is the tool response metadata key under which the number of attempts
+// made is recorded when retries are enabled.
+const MCPToolAttemptsMetadataKey = "attempts"
+
+const (
+	defaultMCPRetryInitialBackoff = 200 * time.Millisecond
+	defaultMCPRetryMaxBackoff     = 10 * time.Second
+)
+
+// MCPRetryPolicy retries tool calls that fail transiently: the session could not be created, the
+// connection dropped, or an HTTP server answered 429, 502, 503 or 504. Every attempt obtains a fresh
+// session from the session maker (or the pool), so crashed stdio servers are restarted.
+//
+// Calls that reached the server are only retried for tools annotated as read-only or idempotent,
+// unless RetryAnyTool is set.
+type MCPRetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. Zero or one disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubling with every further attempt.
+	// Defaults to 200 milliseconds. Delays are jittered by up to half.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. Defaults to 10 seconds. A server asking to
+	// Retry-After longer than this is not retried.
+	MaxBackoff time.Duration
+	// RetryAnyTool also retries tools that aren't annotated as read-only or idempotent,
+	// which may repeat their side effects.
+	RetryAnyTool bool
+}
+
+func (p MCPRetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// backoff returns the delay before the given retry (1 for the first retry).
+func (p MCPRetryPolicy) backoff(retry int, retryAfter time.Duration) (time.Duration, bool) {
+	initial, maxBackoff := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = defaultMCPRetryInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMCPRetryMaxBackoff
+	}
+	if retryAfter > maxBackoff {
+		return 0, false
+	}
+	delay := maxBackoff
+	if shift := retry - 1; shift < 32 && initial<<shift < maxBackoff {
+		delay = initial << shift
+	}
+	delay -= time.Duration(rand.Int64N(int64(delay)/2 + 1))
+	return max(delay, retryAfter), true
+}
+
+// callWithRetries runs call until it succeeds, fails permanently, or the policy gives up,
+// returning the number of attempts made.
+func (t *mcpFantasyTool) callWithRetries(ctx context.Context, call func(context.Context) error) (int, error) {
+	policy := t.options.Retry
+	for attempt := 1; ; attempt++ {
+		status := &mcpHTTPStatus{}
+		err := call(context.WithValue(ctx, mcpHTTPStatusContextKey{}, status))
+		if err == nil {
+			return attempt, nil
+		}
+		_, retryAfter := status.get()
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil || !t.retryable(err) {
+			return attempt, err
+		}
+		delay, ok := policy.backoff(attempt, retryAfter)
+		if !ok {
+			return attempt, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		}
+	}
+}
+
+func (t *mcpFantasyTool) retryable(err error) bool {
+	// the call never reached the server
+	if errors.Is(err, errMCPSessionCreation) {
+		return true
+	}
+	if !isMCPTransportError(err) && !isMCPHTTPStatusError(err) {
+		return false
+	}
+	return t.options.Retry.RetryAnyTool || isIdempotentMCPTool(t.mcpTool)
+}
+
+func isIdempotentMCPTool(tool *mcp.Tool) bool {
+	if tool == nil || tool.Annotations == nil {
+		return false
+	}
+	return tool.Annotations.ReadOnlyHint || tool.Annotations.IdempotentHint
+}
+
+// MCPRetryAfterRoundTripper wraps an http.RoundTripper (http.DefaultTransport if nil) so that MCP
+// tool calls made over HTTP can tell rate limiting and temporary unavailability apart from other
+// failures, and honor the server's Retry-After header. Use it in the HTTP client of the
+// streamable transport:
+//
+//	transport := &mcp.StreamableClientTransport{
+//		Endpoint:   endpoint,
+//		HTTPClient: &http.Client{Transport: fantasyextensions.MCPRetryAfterRoundTripper(nil)},
+//	}
+func MCPRetryAfterRoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return mcpRetryAfterRoundTripper{base: base}
+}
+
+type mcpRetryAfterRoundTripper struct {
+	base http.RoundTripper
+}
+
+func (rt mcpRetryAfterRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	status, ok := req.Context().Value(mcpHTTPStatusContextKey{}).(*mcpHTTPStatus)
+	if ok && isRetryableHTTPStatus(resp.StatusCode) {
+		status.set(resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After")))
+	}
+	return resp, err
+}
+
+type mcpHTTPStatusContextKey struct{}
+
+// wrapMCPHTTPStatus marks err as caused by the retryable HTTP status recorded in ctx, if any.
+func wrapMCPHTTPStatus(ctx context.Context, err error) error {
+	status, ok := ctx.Value(mcpHTTPStatusContextKey{}).(*mcpHTTPStatus)
+	if !ok || err == nil {
+		return err
+	}
+	if statusCode, _ := status.get(); statusCode != 0 {
+		return &mcpHTTPStatusError{statusCode: statusCode, err: err}
+	}
+	return err
+}
+
+// mcpHTTPStatus records a retryable HTTP response seen during one attempt.
+type mcpHTTPStatus struct {
+	mu         sync.Mutex
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (s *mcpHTTPStatus) set(statusCode int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusCode = statusCode
+	s.retryAfter = retryAfter
+}
+
+func (s *mcpHTTPStatus) get() (int, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusCode, s.retryAfter
+}
+
+// mcpHTTPStatusError marks a failure caused by a retryable HTTP status. It is reported as a
+// transport error, but unlike a dropped connection the request may well have been processed, so
+// only the retry policy decides whether to repeat it.
+type mcpHTTPStatusError struct {
+	statusCode int
+	err        error
+}
+
+func (e *mcpHTTPStatusError) Error() string {
+	return fmt.Sprintf("%v (HTTP %d)", e.err, e.statusCode)
+}
+
+func (e *mcpHTTPStatusError) Unwrap() error {
+	return e.err
+}
+
+func isMCPHTTPStatusError(err error) bool {
+	var statusErr *mcpHTTPStatusError
+	return errors.As(err, &statusErr)
+}
+
+func isRetryableHTTPStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
@@ -0,0 +1,295 @@
+package fantasyextensions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newFlakyMCPServer returns a server whose tools drop the connection on their first call.
+func newFlakyMCPServer(calls *atomic.Int32) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "flaky", Version: "1.0.0"}, nil)
+	emptySchema := map[string]any{"type": "object"}
+	handler := func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if calls.Add(1) == 1 {
+			// hold the response until the connection is gone
+			go func() { _ = req.Session.Close() }()
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "ok"}}}, nil
+	}
+	server.AddTool(&mcp.Tool{Name: "lookup", InputSchema: emptySchema, Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}}, handler)
+	server.AddTool(&mcp.Tool{Name: "upsert", InputSchema: emptySchema, Annotations: &mcp.ToolAnnotations{IdempotentHint: true}}, handler)
+	server.AddTool(&mcp.Tool{Name: "charge", InputSchema: emptySchema}, handler)
+	return server
+}
+
+func mcpToolAttempts(t *testing.T, resp fantasy.ToolResponse) int {
+	t.Helper()
+	var metadata struct {
+		Attempts int `json:"attempts"`
+	}
+	if err := json.Unmarshal([]byte(resp.Metadata), &metadata); err != nil {
+		t.Fatalf("failed to decode metadata %q: %v", resp.Metadata, err)
+	}
+	return metadata.Attempts
+}
+
+func TestMCPTools_RetriesDroppedConnections(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		tool             string
+		retryAnyTool     bool
+		expectedSuccess  bool
+		expectedAttempts int
+	}{
+		{name: "read only tool", tool: "lookup", expectedSuccess: true, expectedAttempts: 2},
+		{name: "idempotent tool", tool: "upsert", expectedSuccess: true, expectedAttempts: 2},
+		{name: "other tools are not retried", tool: "charge", expectedAttempts: 1},
+		{name: "other tools retried when allowed", tool: "charge", retryAnyTool: true, expectedSuccess: true, expectedAttempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			var calls atomic.Int32
+			sessionMaker, connections := newTestMCPSessionMaker(t, newFlakyMCPServer(&calls), nil)
+			tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{Retry: MCPRetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				RetryAnyTool:   tt.retryAnyTool,
+			}})
+			connections.Store(0)
+
+			// When
+			resp, err := tools[tt.tool].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: tt.tool, Input: "{}"})
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			toolErr := MCPToolResponseError(resp)
+			if tt.expectedSuccess && toolErr != nil {
+				t.Fatalf("unexpected tool error: %v", toolErr)
+			}
+			if !tt.expectedSuccess && !errors.Is(toolErr, ErrMCPTransport) {
+				t.Fatalf("expected a transport error, got %v", toolErr)
+			}
+			if got := mcpToolAttempts(t, resp); got != tt.expectedAttempts {
+				t.Fatalf("expected %d attempts, got %d", tt.expectedAttempts, got)
+			}
+			if got := connections.Load(); got != int32(tt.expectedAttempts) {
+				t.Fatalf("expected a new session per attempt (%d), got %d", tt.expectedAttempts, got)
+			}
+		})
+	}
+}
+
+func TestMCPTools_RetriesSessionCreation(t *testing.T) {
+	t.Parallel()
+	// Given
+	var calls atomic.Int32
+	sessionMaker, _ := newTestMCPSessionMaker(t, newFlakyMCPServer(&calls), nil)
+	calls.Store(1) // don't drop the connection
+	var failures atomic.Int32
+	flakySessionMaker := func(ctx context.Context) (*mcp.ClientSession, error) {
+		if failures.Add(1) <= 2 {
+			return nil, errors.New("subprocess exited")
+		}
+		return sessionMaker(ctx)
+	}
+	tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{Retry: MCPRetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}})
+	tool := tools["charge"].(*mcpFantasyTool)
+	tool.sessions = &mcpSessionMakerProvider{sessionMaker: flakySessionMaker}
+
+	// When
+	resp, err := tool.Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: "charge", Input: "{}"})
+
+	// Then
+	if err != nil || resp.IsError {
+		t.Fatalf("unexpected failure: %v %s", err, resp.Content)
+	}
+	if got := mcpToolAttempts(t, resp); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestMCPTools_HonorsRetryAfter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		maxBackoff       time.Duration
+		expectedSuccess  bool
+		expectedAttempts int
+		expectedMinDelay time.Duration
+	}{
+		{name: "waits as asked", expectedSuccess: true, expectedAttempts: 2, expectedMinDelay: time.Second},
+		{name: "gives up when asked to wait too long", maxBackoff: 500 * time.Millisecond, expectedAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			var calls atomic.Int32
+			calls.Store(1) // don't drop the connection
+			mcpHandler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return newFlakyMCPServer(&calls) }, nil)
+			var limited atomic.Bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				if bytes.Contains(body, []byte(`"tools/call"`)) && limited.CompareAndSwap(false, true) {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				mcpHandler.ServeHTTP(w, r)
+			}))
+			t.Cleanup(server.Close)
+			client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+			sessionMaker := func(ctx context.Context) (*mcp.ClientSession, error) {
+				return client.Connect(ctx, &mcp.StreamableClientTransport{
+					Endpoint:   server.URL,
+					HTTPClient: &http.Client{Transport: MCPRetryAfterRoundTripper(nil)},
+				}, nil)
+			}
+			tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{Retry: MCPRetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     tt.maxBackoff,
+			}})
+
+			// When
+			start := time.Now()
+			resp, err := tools["lookup"].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: "lookup", Input: "{}"})
+			elapsed := time.Since(start)
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			toolErr := MCPToolResponseError(resp)
+			if tt.expectedSuccess && toolErr != nil {
+				t.Fatalf("unexpected tool error: %v", toolErr)
+			}
+			if !tt.expectedSuccess && !errors.Is(toolErr, ErrMCPTransport) {
+				t.Fatalf("expected a transport error, got %v", toolErr)
+			}
+			if got := mcpToolAttempts(t, resp); got != tt.expectedAttempts {
+				t.Fatalf("expected %d attempts, got %d", tt.expectedAttempts, got)
+			}
+			if elapsed < tt.expectedMinDelay {
+				t.Fatalf("expected to wait at least %s, waited %s", tt.expectedMinDelay, elapsed)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{name: "missing", value: "", expected: 0},
+		{name: "seconds", value: "3", expected: 3 * time.Second},
+		{name: "garbage", value: "soon", expected: 0},
+		{name: "date in the past", value: "Wed, 21 Oct 2015 07:28:00 GMT", expected: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := parseRetryAfter(tt.value); got != tt.expected {
+				t.Fatalf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMCPTools_LeavesHTTPStatusRetriesToThePolicy(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		tool             string
+		statusCode       int
+		expectedSuccess  bool
+		expectedRequests int32
+	}{
+		{name: "non-idempotent tool unavailable", tool: "charge", statusCode: http.StatusServiceUnavailable, expectedRequests: 1},
+		{name: "non-idempotent tool gateway timeout", tool: "charge", statusCode: http.StatusGatewayTimeout, expectedRequests: 1},
+		{name: "read only tool unavailable", tool: "lookup", statusCode: http.StatusServiceUnavailable, expectedSuccess: true, expectedRequests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			var calls atomic.Int32
+			calls.Store(1) // don't drop the connection
+			mcpHandler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return newFlakyMCPServer(&calls) }, nil)
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				if bytes.Contains(body, []byte(`"tools/call"`)) && requests.Add(1) == 1 {
+					w.WriteHeader(tt.statusCode)
+					return
+				}
+				mcpHandler.ServeHTTP(w, r)
+			}))
+			t.Cleanup(server.Close)
+			client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+			sessionMaker := func(ctx context.Context) (*mcp.ClientSession, error) {
+				return client.Connect(ctx, &mcp.StreamableClientTransport{
+					Endpoint:   server.URL,
+					HTTPClient: &http.Client{Transport: MCPRetryAfterRoundTripper(nil)},
+				}, nil)
+			}
+			pool := NewMCPSessionPool(sessionMaker, MCPSessionPoolOptions{})
+			defer pool.Close()
+			session, err := pool.Acquire(context.Background())
+			if err != nil {
+				t.Fatalf("failed to acquire session: %v", err)
+			}
+			pool.Release(session, nil)
+			tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{
+				SessionPool: pool,
+				Retry:       MCPRetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			})
+
+			// When
+			resp, err := tools[tt.tool].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: tt.tool, Input: "{}"})
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			toolErr := MCPToolResponseError(resp)
+			if tt.expectedSuccess && toolErr != nil {
+				t.Fatalf("unexpected tool error: %v", toolErr)
+			}
+			if !tt.expectedSuccess && !errors.Is(toolErr, ErrMCPTransport) {
+				t.Fatalf("expected a transport error, got %v", toolErr)
+			}
+			if got := requests.Load(); got != tt.expectedRequests {
+				t.Fatalf("expected %d tool call requests, got %d", tt.expectedRequests, got)
+			}
+			if got := mcpToolAttempts(t, resp); got != int(tt.expectedRequests) {
+				t.Fatalf("expected %d attempts, got %d", tt.expectedRequests, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ErrMCPSamplingRefused is returned to MCP servers whose sampling requests are refused by policy.
+var ErrMCPSamplingRefused = errors.New("sampling request refused")
+
+// MCPSamplingRequest describes a server's request to sample the language model.
+type MCPSamplingRequest struct {
+	// ServerName is the name the server gave when the session was initialized. Servers choose it
+	// themselves, so it identifies nothing and must not be used to decide trust.
+	ServerName string
+	// ToolCallID and ToolName identify the tool call during which the server asked, if any.
+	ToolCallID string
+	ToolName   string
+	Params     *mcp.CreateMessageParams
+}
+
+// MCPSamplingPolicy decides whether a sampling request may proceed; returning an error refuses it.
+type MCPSamplingPolicy func(ctx context.Context, req MCPSamplingRequest) error
+
+type MCPSamplingOptions struct {
+	// Models are offered to servers expressing model preferences: the first model whose name
+	// contains one of the server's hints is used. Otherwise the default model is used.
+	Models []fantasy.LanguageModel
+	// MaxTokens caps the tokens generated per request, whatever the server asks for. Zero means no cap.
+	MaxTokens int64
+	// TokenBudget caps the tokens (input and output) used across all requests handled by the
+	// handler; requests are refused once it is spent. Zero means no budget.
+	TokenBudget int64
+	// Policy, if set, is consulted before every request, e.g. to ask a human with MCPSamplingApproval.
+	Policy MCPSamplingPolicy
+}
+
+// NewMCPSamplingHandler returns a handler serving sampling/createMessage requests from MCP servers
+// with model. Use it as mcp.ClientOptions.CreateMessageHandler:
+//
+//	client := mcp.NewClient(impl, &mcp.ClientOptions{
+//		CreateMessageHandler: fantasyextensions.NewMCPSamplingHandler(model, fantasyextensions.MCPSamplingOptions{}),
+//	})
+//
+// The handler serves every server connected through the client it is installed on, so install it
+// only on clients for servers trusted to spend the model's tokens, with a handler per client for
+// separate budgets.
+//
+// Requests made by a server while it handles a tool call are served with the context of the call,
+// so that a policy such as MCPSamplingApproval with an AGUIApprover can reach the user of the run.
+// Stop sequences are applied to the generated text, as fantasy models don't take them.
+func NewMCPSamplingHandler(model fantasy.LanguageModel, options MCPSamplingOptions) func(context.Context, *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	s := &mcpSampler{model: model, options: options}
+	return s.createMessage
+}
+
+// MCPSamplingApproval adapts an Approver into a sampling policy. The approver sees the request as a
+// call to a tool named "sampling/createMessage" whose input is the request's parameters.
+func MCPSamplingApproval(approver Approver) MCPSamplingPolicy {
+	return func(ctx context.Context, req MCPSamplingRequest) error {
+		input, err := json.Marshal(req.Params)
+		if err != nil {
+			return err
+		}
+		decision, err := approver(ctx, MCPApprovalRequest{ToolCallID: req.ToolCallID, ToolName: "sampling/createMessage", Input: string(input)})
+		if err != nil {
+			return err
+		}
+		if !decision.Approved {
+			if decision.Reason != "" {
+				return fmt.Errorf("%w: %s", ErrMCPSamplingRefused, decision.Reason)
+			}
+			return ErrMCPSamplingRefused
+		}
+		return nil
+	}
+}
+
+type mcpSampler struct {
+	model   fantasy.LanguageModel
+	options MCPSamplingOptions
+
+	mu   sync.Mutex
+	used int64
+}
+
+func (s *mcpSampler) createMessage(ctx context.Context, req *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	params := req.Params
+	if params == nil {
+		return nil, errors.New("missing sampling parameters")
+	}
+	ctx, sessionCall, cancel := withMCPSessionCallContext(ctx, req.Session)
+	defer cancel()
+	request := MCPSamplingRequest{ServerName: mcpServerName(req.Session), Params: params}
+	if sessionCall != nil {
+		request.ToolCallID = sessionCall.toolCallID
+		request.ToolName = sessionCall.toolName
+	}
+	maxTokens := params.MaxTokens
+	if s.options.MaxTokens > 0 && (maxTokens <= 0 || maxTokens > s.options.MaxTokens) {
+		maxTokens = s.options.MaxTokens
+	}
+	var reserved int64
+	if s.options.TokenBudget > 0 {
+		var ok bool
+		if maxTokens, ok = s.reserve(maxTokens); !ok {
+			return nil, fmt.Errorf("%w: sampling token budget is spent", ErrMCPSamplingRefused)
+		}
+		reserved = maxTokens
+	}
+	if s.options.Policy != nil {
+		if err := s.options.Policy(ctx, request); err != nil {
+			s.spend(reserved, fantasy.Usage{})
+			if errors.Is(err, ErrMCPSamplingRefused) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %w", ErrMCPSamplingRefused, err)
+		}
+	}
+
+	call, err := mcpSamplingCall(params, maxTokens)
+	if err != nil {
+		s.spend(reserved, fantasy.Usage{})
+		return nil, err
+	}
+	model := s.selectModel(params.ModelPreferences)
+	resp, err := model.Generate(ctx, call)
+	if err != nil {
+		s.spend(reserved, fantasy.Usage{})
+		return nil, err
+	}
+	s.spend(reserved, resp.Usage)
+	return mcpSamplingResult(model, resp, params.StopSequences), nil
+}
+
+func (s *mcpSampler) selectModel(preferences *mcp.ModelPreferences) fantasy.LanguageModel {
+	if preferences == nil {
+		return s.model
+	}
+	for _, hint := range preferences.Hints {
+		if hint == nil || hint.Name == "" {
+			continue
+		}
+		for _, model := range s.options.Models {
+			if strings.Contains(model.Model(), hint.Name) {
+				return model
+			}
+		}
+	}
+	return s.model
+}
+
+// reserve sets aside up to maxTokens (all that remains if zero) of the budget for a request, so
+// that concurrent requests can't overspend it. It reports false if the budget is spent.
+func (s *mcpSampler) reserve(maxTokens int64) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remaining := s.options.TokenBudget - s.used
+	if remaining <= 0 {
+		return 0, false
+	}
+	if maxTokens <= 0 || maxTokens > remaining {
+		maxTokens = remaining
+	}
+	s.used += maxTokens
+	return maxTokens, true
+}
+
+// spend replaces the tokens reserved for a request with those it used.
+func (s *mcpSampler) spend(reserved int64, usage fantasy.Usage) {
+	tokens := usage.TotalTokens
+	if tokens == 0 {
+		tokens = usage.InputTokens + usage.OutputTokens
+	}
+	s.mu.Lock()
+	s.used += tokens - reserved
+	s.mu.Unlock()
+}
+
+func mcpSamplingCall(params *mcp.CreateMessageParams, maxTokens int64) (fantasy.Call, error) {
+	var prompt fantasy.Prompt
+	if params.SystemPrompt != "" {
+		prompt = append(prompt, fantasy.NewSystemMessage(params.SystemPrompt))
+	}
+	for _, message := range params.Messages {
+		if message == nil {
+			continue
+		}
+		role := fantasy.MessageRoleUser
+		if message.Role == "assistant" {
+			role = fantasy.MessageRoleAssistant
+		}
+		part, err := mcpPromptMessagePart(message.Content, role)
+		if err != nil {
+			return fantasy.Call{}, err
+		}
+		prompt = appendMCPMessagePart(prompt, role, part)
+	}
+	call := fantasy.Call{Prompt: prompt}
+	if maxTokens > 0 {
+		call.MaxOutputTokens = &maxTokens
+	}
+	if params.Temperature != 0 {
+		temperature := params.Temperature
+		call.Temperature = &temperature
+	}
+	return call, nil
+}
+
+func mcpSamplingResult(model fantasy.LanguageModel, resp *fantasy.Response, stopSequences []string) *mcp.CreateMessageResult {
+	result := &mcp.CreateMessageResult{Model: model.Model(), Role: "assistant"}
+	switch resp.FinishReason {
+	case fantasy.FinishReasonStop:
+		result.StopReason = "endTurn"
+	case fantasy.FinishReasonLength:
+		result.StopReason = "maxTokens"
+	default:
+		result.StopReason = string(resp.FinishReason)
+	}
+	if text := resp.Content.Text(); text != "" {
+		if cut, ok := cutAtMCPStopSequence(text, stopSequences); ok {
+			text = cut
+			result.StopReason = "stopSequence"
+		}
+		result.Content = &mcp.TextContent{Text: text}
+		return result
+	}
+	for _, file := range resp.Content.Files() {
+		if strings.HasPrefix(file.MediaType, "image/") {
+			result.Content = &mcp.ImageContent{Data: file.Data, MIMEType: file.MediaType}
+			return result
+		}
+	}
+	result.Content = &mcp.TextContent{}
+	return result
+}
+
+// cutAtMCPStopSequence returns text up to the earliest of stopSequences it contains.
+func cutAtMCPStopSequence(text string, stopSequences []string) (string, bool) {
+	end := -1
+	for _, sequence := range stopSequences {
+		if sequence == "" {
+			continue
+		}
+		if i := strings.Index(text, sequence); i >= 0 && (end < 0 || i < end) {
+			end = i
+		}
+	}
+	if end < 0 {
+		return text, false
+	}
+	return text[:end], true
+}
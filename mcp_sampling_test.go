@@ -0,0 +1,257 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// fakeLanguageModel answers every call with a fixed text and records the calls it received.
+type fakeLanguageModel struct {
+	name  string
+	reply string
+
+	mu    sync.Mutex
+	calls []fantasy.Call
+}
+
+func (m *fakeLanguageModel) Generate(_ context.Context, call fantasy.Call) (*fantasy.Response, error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	m.mu.Unlock()
+	return &fantasy.Response{
+		Content:      fantasy.ResponseContent{fantasy.TextContent{Text: m.reply}},
+		FinishReason: fantasy.FinishReasonStop,
+		Usage:        fantasy.Usage{InputTokens: 30, OutputTokens: 20, TotalTokens: 50},
+	}, nil
+}
+
+func (m *fakeLanguageModel) Stream(context.Context, fantasy.Call) (fantasy.StreamResponse, error) {
+	return nil, errors.New("streaming is not supported")
+}
+
+func (m *fakeLanguageModel) Provider() string { return "fake" }
+
+func (m *fakeLanguageModel) Model() string { return m.name }
+
+func (m *fakeLanguageModel) lastCall() fantasy.Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[len(m.calls)-1]
+}
+
+// newSamplingMCPServer returns a server whose "summarize" tool asks the client's model for a summary.
+func newSamplingMCPServer(name string, preferences *mcp.ModelPreferences) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: name, Version: "1.0.0"}, nil)
+	server.AddTool(&mcp.Tool{Name: "summarize", InputSchema: map[string]any{"type": "object"}}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := req.Session.CreateMessage(ctx, &mcp.CreateMessageParams{
+			SystemPrompt:     "You summarize documents.",
+			Messages:         []*mcp.SamplingMessage{{Role: "user", Content: &mcp.TextContent{Text: "Summarize the release notes."}}},
+			MaxTokens:        1000,
+			ModelPreferences: preferences,
+		})
+		if err != nil {
+			return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}}}, nil
+		}
+		text := result.Content.(*mcp.TextContent).Text
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: result.Model + ": " + text}}}, nil
+	})
+	return server
+}
+
+func runSamplingTool(t *testing.T, serverName string, preferences *mcp.ModelPreferences, handler func(context.Context, *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)) fantasy.ToolResponse {
+	t.Helper()
+	sessionMaker, _ := newTestMCPSessionMaker(t, newSamplingMCPServer(serverName, preferences), &mcp.ClientOptions{CreateMessageHandler: handler})
+	tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{})
+	resp, err := tools["summarize"].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: "summarize", Input: "{}"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return resp
+}
+
+func TestMCPSamplingHandler_GeneratesWithModel(t *testing.T) {
+	t.Parallel()
+	// Given
+	model := &fakeLanguageModel{name: "default-model", reply: "All good."}
+	handler := NewMCPSamplingHandler(model, MCPSamplingOptions{MaxTokens: 200})
+
+	// When
+	resp := runSamplingTool(t, "notes", nil, handler)
+
+	// Then
+	if resp.IsError || resp.Content != "default-model: All good." {
+		t.Fatalf("unexpected response: %s", resp.Content)
+	}
+	call := model.lastCall()
+	if call.MaxOutputTokens == nil || *call.MaxOutputTokens != 200 {
+		t.Fatalf("expected max tokens to be capped at 200, got %v", call.MaxOutputTokens)
+	}
+	if len(call.Prompt) != 2 || call.Prompt[0].Role != fantasy.MessageRoleSystem || call.Prompt[1].Role != fantasy.MessageRoleUser {
+		t.Fatalf("expected a system and a user message, got %+v", call.Prompt)
+	}
+	if text := call.Prompt[1].Content[0].(fantasy.TextPart).Text; text != "Summarize the release notes." {
+		t.Fatalf("unexpected user message: %q", text)
+	}
+}
+
+func TestMCPSamplingHandler_SelectsModelFromHints(t *testing.T) {
+	t.Parallel()
+	// Given
+	defaultModel := &fakeLanguageModel{name: "large-model", reply: "long"}
+	smallModel := &fakeLanguageModel{name: "small-model-v2", reply: "short"}
+	handler := NewMCPSamplingHandler(defaultModel, MCPSamplingOptions{Models: []fantasy.LanguageModel{smallModel}})
+	preferences := &mcp.ModelPreferences{Hints: []*mcp.ModelHint{{Name: "unknown"}, {Name: "small-model"}}}
+
+	// When
+	resp := runSamplingTool(t, "notes", preferences, handler)
+
+	// Then
+	if resp.IsError || resp.Content != "small-model-v2: short" {
+		t.Fatalf("unexpected response: %s", resp.Content)
+	}
+}
+
+func TestMCPSamplingHandler_Refusals(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name            string
+		options         MCPSamplingOptions
+		priorRequests   int
+		expectedMessage string
+	}{
+		{name: "budget spent", options: MCPSamplingOptions{TokenBudget: 50}, priorRequests: 1, expectedMessage: "budget is spent"},
+		{name: "denied by a human", options: MCPSamplingOptions{Policy: MCPSamplingApproval(DenyAll)}, expectedMessage: "calls to this tool are not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			model := &fakeLanguageModel{name: "default-model", reply: "All good."}
+			handler := NewMCPSamplingHandler(model, tt.options)
+			for range tt.priorRequests {
+				if resp := runSamplingTool(t, "notes", nil, handler); resp.IsError {
+					t.Fatalf("unexpected error response: %s", resp.Content)
+				}
+			}
+
+			// When
+			resp := runSamplingTool(t, "notes", nil, handler)
+
+			// Then
+			if !resp.IsError || !strings.Contains(resp.Content, tt.expectedMessage) {
+				t.Fatalf("expected a refusal mentioning %q, got %q", tt.expectedMessage, resp.Content)
+			}
+		})
+	}
+}
+
+func TestMCPSamplingHandler_ApprovesWithinTheToolCall(t *testing.T) {
+	t.Parallel()
+	// Given
+	model := &fakeLanguageModel{name: "default-model", reply: "All good."}
+	var approvals []MCPApprovalRequest
+	var runs []*aguiRun
+	approver := func(ctx context.Context, req MCPApprovalRequest) (MCPApprovalDecision, error) {
+		run, _ := aguiRunFromContext(ctx)
+		approvals = append(approvals, req)
+		runs = append(runs, run)
+		return MCPApprovalDecision{Approved: true}, nil
+	}
+	handler := NewMCPSamplingHandler(model, MCPSamplingOptions{Policy: MCPSamplingApproval(approver)})
+	sessionMaker, _ := newTestMCPSessionMaker(t, newSamplingMCPServer("notes", nil), &mcp.ClientOptions{CreateMessageHandler: handler})
+	tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{})
+	run := &aguiRun{threadID: "thread-1", runID: "run-1", writer: newStreamWriter(httptest.NewRecorder())}
+	ctx := context.WithValue(context.Background(), aguiRunContextKey{}, run)
+
+	// When
+	resp, err := tools["summarize"].Run(ctx, fantasy.ToolCall{ID: "call-1", Name: "summarize", Input: "{}"})
+
+	// Then
+	if err != nil || resp.IsError {
+		t.Fatalf("unexpected error: %v %s", err, resp.Content)
+	}
+	if len(approvals) != 1 || approvals[0].ToolCallID != "call-1" {
+		t.Fatalf("expected the approval to be tied to the tool call, got %+v", approvals)
+	}
+	if runs[0] != run {
+		t.Fatalf("expected the approver to reach the run of the tool call")
+	}
+}
+
+func TestMCPSamplingHandler_ReservesTokenBudget(t *testing.T) {
+	t.Parallel()
+	// Given
+	model := &fakeLanguageModel{name: "default-model", reply: "All good."}
+	approving := make(chan struct{})
+	approve := make(chan struct{})
+	handler := NewMCPSamplingHandler(model, MCPSamplingOptions{
+		TokenBudget: 100,
+		Policy: func(context.Context, MCPSamplingRequest) error {
+			approving <- struct{}{}
+			<-approve
+			return nil
+		},
+	})
+	request := &mcp.CreateMessageRequest{Params: &mcp.CreateMessageParams{
+		Messages:  []*mcp.SamplingMessage{{Role: "user", Content: &mcp.TextContent{Text: "Summarize the release notes."}}},
+		MaxTokens: 100,
+	}}
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := handler(context.Background(), request)
+		firstErr <- err
+	}()
+	<-approving
+
+	// When
+	_, err := handler(context.Background(), request)
+
+	// Then
+	if !errors.Is(err, ErrMCPSamplingRefused) {
+		t.Fatalf("expected the budget reserved by the pending request to be spent, got %v", err)
+	}
+	close(approve)
+	if err := <-firstErr; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the first request used 50 tokens, returning the rest of its reservation
+	go func() { <-approving }()
+	if _, err := handler(context.Background(), request); err != nil {
+		t.Fatalf("expected the unused reservation to be returned, got %v", err)
+	}
+	if call := model.lastCall(); call.MaxOutputTokens == nil || *call.MaxOutputTokens != 50 {
+		t.Fatalf("expected max tokens to be capped at the remaining 50, got %v", call.MaxOutputTokens)
+	}
+}
+
+func TestMCPSamplingHandler_AppliesStopSequences(t *testing.T) {
+	t.Parallel()
+	// Given
+	model := &fakeLanguageModel{name: "default-model", reply: "All good.\nEND\nUnrelated text."}
+	handler := NewMCPSamplingHandler(model, MCPSamplingOptions{})
+	request := &mcp.CreateMessageRequest{Params: &mcp.CreateMessageParams{
+		Messages:      []*mcp.SamplingMessage{{Role: "user", Content: &mcp.TextContent{Text: "Summarize the release notes."}}},
+		StopSequences: []string{"STOP", "\nEND"},
+	}}
+
+	// When
+	result, err := handler(context.Background(), request)
+
+	// Then
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if text := result.Content.(*mcp.TextContent).Text; text != "All good." {
+		t.Fatalf("expected the text to stop at the stop sequence, got %q", text)
+	}
+	if result.StopReason != "stopSequence" {
+		t.Fatalf("expected stop reason stopSequence, got %q", result.StopReason)
+	}
+}
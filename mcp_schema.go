@@ -0,0 +1,268 @@
+package fantasyextensions
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MCPSchemaOptions downgrades JSON Schema constructs that a provider doesn't accept.
+// For example, Gemini rejects "$schema", "additionalProperties" and "const":
+//
+//	MCPSchemaOptions{StripKeywords: []string{"$schema", "additionalProperties"}, ConstToEnum: true}
+type MCPSchemaOptions struct {
+	// StripKeywords are removed from every (sub)schema.
+	StripKeywords []string
+	// ConstToEnum rewrites "const": v as "enum": [v].
+	ConstToEnum bool
+	// Transform, if set, is applied to every (sub)schema after the other options, and may modify it in place.
+	Transform func(schema map[string]any)
+}
+
+// normalizedMCPSchema is an MCP input schema reduced to what fantasy.ToolInfo can express.
+type normalizedMCPSchema struct {
+	properties  map[string]any
+	required    []string
+	description string
+}
+
+// normalizeMCPInputSchema resolves local $refs, inlines definitions and folds root level
+// compositions into a single set of properties. Parameterless schemas yield no properties.
+func normalizeMCPInputSchema(inputSchema any, options MCPSchemaOptions) (normalizedMCPSchema, error) {
+	if inputSchema == nil {
+		return normalizedMCPSchema{properties: map[string]any{}, required: []string{}}, nil
+	}
+	root, ok := inputSchema.(map[string]any)
+	if !ok {
+		return normalizedMCPSchema{}, fmt.Errorf("input schema is not a map[string]any; instead got: %T", inputSchema)
+	}
+	r := &mcpSchemaResolver{root: root, options: options, resolving: map[string]bool{}}
+	resolved, ok := r.resolve(root).(map[string]any)
+	if !ok {
+		return normalizedMCPSchema{}, fmt.Errorf("input schema does not resolve to an object schema")
+	}
+
+	result := normalizedMCPSchema{properties: map[string]any{}, required: []string{}}
+	if description, ok := resolved["description"].(string); ok {
+		result.description = description
+	}
+	if err := mergeMCPObjectSchema(&result, resolved, true); err != nil {
+		return normalizedMCPSchema{}, err
+	}
+	if allOf, ok := resolved["allOf"].([]any); ok {
+		for _, branch := range allOf {
+			if branch, ok := branch.(map[string]any); ok {
+				if err := mergeMCPObjectSchema(&result, branch, true); err != nil {
+					return normalizedMCPSchema{}, err
+				}
+			}
+		}
+	}
+	// alternatives can't be expressed at the root of a tool's parameters; offer the union of their
+	// properties and only require what every alternative requires
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		branches, ok := resolved[keyword].([]any)
+		if !ok {
+			continue
+		}
+		var common []string
+		for i, branch := range branches {
+			branch, ok := branch.(map[string]any)
+			if !ok {
+				continue
+			}
+			if err := mergeMCPObjectSchema(&result, branch, false); err != nil {
+				return normalizedMCPSchema{}, err
+			}
+			required, err := mcpSchemaRequired(branch)
+			if err != nil {
+				return normalizedMCPSchema{}, err
+			}
+			if i == 0 {
+				common = required
+			} else {
+				common = slices.DeleteFunc(common, func(name string) bool { return !slices.Contains(required, name) })
+			}
+		}
+		for _, name := range common {
+			if !slices.Contains(result.required, name) {
+				result.required = append(result.required, name)
+			}
+		}
+	}
+	return result, nil
+}
+
+func mergeMCPObjectSchema(result *normalizedMCPSchema, schema map[string]any, includeRequired bool) error {
+	if schema["properties"] != nil {
+		properties, ok := schema["properties"].(map[string]any)
+		if !ok {
+			return fmt.Errorf("properties is not a map[string]any; instead got: %T", schema["properties"])
+		}
+		for name, property := range properties {
+			if _, ok := result.properties[name]; !ok {
+				result.properties[name] = property
+			}
+		}
+	}
+	if !includeRequired {
+		return nil
+	}
+	required, err := mcpSchemaRequired(schema)
+	if err != nil {
+		return err
+	}
+	for _, name := range required {
+		if !slices.Contains(result.required, name) {
+			result.required = append(result.required, name)
+		}
+	}
+	return nil
+}
+
+func mcpSchemaRequired(schema map[string]any) ([]string, error) {
+	if schema["required"] == nil {
+		return nil, nil
+	}
+	values, ok := schema["required"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("required is not a []string; instead got: %T", schema["required"])
+	}
+	required := make([]string, 0, len(values))
+	for _, value := range values {
+		name, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("required is not a []string; instead got element: %T", value)
+		}
+		required = append(required, name)
+	}
+	return required, nil
+}
+
+type mcpSchemaResolver struct {
+	root    map[string]any
+	options MCPSchemaOptions
+	// resolving holds the $refs currently being inlined, to break cycles
+	resolving map[string]bool
+}
+
+// Keywords whose values are schemas, maps of schemas or lists of schemas. Only these are resolved;
+// other values, like the keys of "properties" or the values of "enum" and "default", are copied as is.
+var (
+	mcpSubschemaKeywords     = []string{"items", "additionalProperties", "additionalItems", "not", "contains", "propertyNames", "if", "then", "else", "unevaluatedItems", "unevaluatedProperties"}
+	mcpSubschemaMapKeywords  = []string{"properties", "patternProperties", "dependentSchemas"}
+	mcpSubschemaListKeywords = []string{"anyOf", "oneOf", "allOf", "prefixItems"}
+	mcpSchemaInlinedKeywords = []string{"$ref", "$defs", "definitions"}
+)
+
+// resolve returns a copy of schema with local $refs inlined and the schema options applied.
+// Values that aren't schemas, e.g. booleans allowed for "additionalProperties", are copied as is.
+func (r *mcpSchemaResolver) resolve(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		return r.resolveSchema(v)
+	case []any:
+		// "items" may still be a list of schemas, as before prefixItems
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = r.resolve(item)
+		}
+		return result
+	default:
+		return copyMCPSchemaValue(v)
+	}
+}
+
+func (r *mcpSchemaResolver) resolveSchema(schema map[string]any) map[string]any {
+	result := map[string]any{}
+	if ref, ok := schema["$ref"].(string); ok {
+		if target, ok := r.lookup(ref); ok && !r.resolving[ref] {
+			r.resolving[ref] = true
+			for key, value := range r.resolveSchema(target) {
+				result[key] = value
+			}
+			delete(r.resolving, ref)
+		} else if r.resolving[ref] {
+			// recursive schemas can't be inlined; accept any object past the first level
+			result["type"] = "object"
+		}
+	}
+	for key, value := range schema {
+		switch {
+		case slices.Contains(mcpSchemaInlinedKeywords, key):
+			continue
+		case slices.Contains(mcpSubschemaKeywords, key):
+			result[key] = r.resolve(value)
+		case slices.Contains(mcpSubschemaMapKeywords, key):
+			subschemas, ok := value.(map[string]any)
+			if !ok {
+				result[key] = copyMCPSchemaValue(value)
+				continue
+			}
+			// the keys are names, not keywords, and are kept as they are
+			resolved := make(map[string]any, len(subschemas))
+			for name, subschema := range subschemas {
+				resolved[name] = r.resolve(subschema)
+			}
+			result[key] = resolved
+		case slices.Contains(mcpSubschemaListKeywords, key):
+			result[key] = r.resolve(value)
+		default:
+			result[key] = copyMCPSchemaValue(value)
+		}
+	}
+
+	for _, keyword := range r.options.StripKeywords {
+		delete(result, keyword)
+	}
+	if constValue, ok := result["const"]; ok && r.options.ConstToEnum {
+		delete(result, "const")
+		result["enum"] = []any{constValue}
+	}
+	if r.options.Transform != nil {
+		r.options.Transform(result)
+	}
+	return result
+}
+
+// copyMCPSchemaValue deep copies a JSON value, so that options modifying the normalized schema
+// never modify the tool's schema.
+func copyMCPSchemaValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = copyMCPSchemaValue(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = copyMCPSchemaValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// lookup resolves a local JSON pointer reference such as "#/$defs/Item".
+func (r *mcpSchemaResolver) lookup(ref string) (map[string]any, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+	var current any = r.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current = m[token]
+	}
+	schema, ok := current.(map[string]any)
+	return schema, ok
+}
@@ -1,8 +1,12 @@
 package fantasyextensions
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
+	"sync/atomic"
 	"testing"
 
 	"charm.land/fantasy"
@@ -33,7 +37,7 @@ func Test_toolInfoFromMCPTool(t *testing.T) {
 	}
 
 	// When
-	toolInfo, err := toolInfoFromMCPTool(mcpTool)
+	toolInfo, err := toolInfoFromMCPTool(mcpTool, MCPSchemaOptions{})
 	if err != nil {
 		t.Fatalf("failed to get tool info: %v", err)
 	}
@@ -52,3 +56,311 @@ func Test_toolInfoFromMCPTool(t *testing.T) {
 		t.Fatalf("tool info does not match expected tool info: %v", toolInfo)
 	}
 }
+
+// newTestMCPSessionMaker returns a session maker connecting to server over in-memory transports,
+// along with a counter of the sessions it has created.
+func newTestMCPSessionMaker(t *testing.T, server *mcp.Server, clientOptions *mcp.ClientOptions) (MCPSessionMaker, *atomic.Int32) {
+	t.Helper()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, clientOptions)
+	connections := &atomic.Int32{}
+	sessionMaker := func(ctx context.Context) (*mcp.ClientSession, error) {
+		serverTransport, clientTransport := mcp.NewInMemoryTransports()
+		if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+			return nil, err
+		}
+		connections.Add(1)
+		return client.Connect(ctx, clientTransport, nil)
+	}
+	return sessionMaker, connections
+}
+
+type echoInput struct {
+	Message string `json:"message"`
+}
+
+func newEchoMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "echo", Version: "1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo", Description: "Echo the message"}, func(_ context.Context, _ *mcp.CallToolRequest, input echoInput) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: input.Message}}}, nil, nil
+	})
+	return server
+}
+
+func newPagedMCPServer(toolCount int) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "paged", Version: "1.0.0"}, &mcp.ServerOptions{PageSize: 2})
+	for i := range toolCount {
+		mcp.AddTool(server, &mcp.Tool{Name: fmt.Sprintf("tool_%d", i)}, func(_ context.Context, _ *mcp.CallToolRequest, input echoInput) (*mcp.CallToolResult, any, error) {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: input.Message}}}, nil, nil
+		})
+	}
+	return server
+}
+
+func TestMCPTools_FollowsPaginationCursors(t *testing.T) {
+	t.Parallel()
+	// Given
+	sessionMaker, _ := newTestMCPSessionMaker(t, newPagedMCPServer(5), nil)
+
+	// When
+	tools, err := MCPTools(context.Background(), sessionMaker)
+
+	// Then
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	if len(tools) != 5 {
+		t.Fatalf("expected 5 tools, got %d", len(tools))
+	}
+}
+
+func TestMCPTools_EnforcesToolAndPageCaps(t *testing.T) {
+	t.Parallel()
+	sessionMaker, _ := newTestMCPSessionMaker(t, newPagedMCPServer(5), nil)
+	tests := []struct {
+		name          string
+		options       MCPToolsOptions
+		expectedTools []string
+	}{
+		{name: "max tools", options: MCPToolsOptions{MaxTools: 3}, expectedTools: []string{"tool_0", "tool_1", "tool_2"}},
+		{name: "max tools on a page boundary", options: MCPToolsOptions{MaxTools: 2, MaxPages: 1}, expectedTools: []string{"tool_0", "tool_1"}},
+		{name: "max tools after filtering", options: MCPToolsOptions{MaxTools: 2, Filter: MCPToolFilter{Deny: []string{"tool_0"}}}, expectedTools: []string{"tool_1", "tool_2"}},
+		{name: "max pages", options: MCPToolsOptions{MaxPages: 2}, expectedTools: []string{"tool_0", "tool_1", "tool_2", "tool_3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tools, err := MCPToolsWithOptions(context.Background(), sessionMaker, tt.options)
+			if err != nil {
+				t.Fatalf("failed to list tools: %v", err)
+			}
+			var names []string
+			for _, tool := range tools {
+				names = append(names, tool.Info().Name)
+			}
+			if !reflect.DeepEqual(names, tt.expectedTools) {
+				t.Fatalf("expected tools %v, got %v", tt.expectedTools, names)
+			}
+		})
+	}
+}
+
+func TestMCPTools_DetectsLoopingCursor(t *testing.T) {
+	t.Parallel()
+	// Given
+	server := newPagedMCPServer(5)
+	server.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if params, ok := req.GetParams().(*mcp.ListToolsParams); ok {
+				params.Cursor = ""
+			}
+			result, err := next(ctx, method, req)
+			if listToolsResult, ok := result.(*mcp.ListToolsResult); ok && listToolsResult != nil {
+				listToolsResult.NextCursor = "same-cursor"
+			}
+			return result, err
+		}
+	})
+	sessionMaker, _ := newTestMCPSessionMaker(t, server, nil)
+
+	// When
+	_, err := MCPTools(context.Background(), sessionMaker)
+
+	// Then
+	if !errors.Is(err, ErrMCPToolsCursorLoop) {
+		t.Fatalf("expected cursor loop error, got: %v", err)
+	}
+}
+
+func Test_toolInfoFromMCPTool_NormalizesSchemas(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		tool             string
+		options          MCPSchemaOptions
+		expectedToolInfo fantasy.ToolInfo
+	}{
+		{
+			name: "zero argument tool",
+			tool: `{"name": "get_time", "description": "Get the time", "inputSchema": {"type": "object"}}`,
+			expectedToolInfo: fantasy.ToolInfo{
+				Name:        "get_time",
+				Description: "Get the time",
+				Parameters:  map[string]any{},
+				Required:    []string{},
+			},
+		},
+		{
+			name: "pydantic $defs from a python server",
+			tool: `{
+				"name": "create_issue",
+				"inputSchema": {
+					"$defs": {
+						"Label": {"properties": {"name": {"type": "string"}}, "required": ["name"], "title": "Label", "type": "object"},
+						"Priority": {"enum": ["low", "high"], "title": "Priority", "type": "string"}
+					},
+					"properties": {
+						"labels": {"items": {"$ref": "#/$defs/Label"}, "type": "array"},
+						"priority": {"$ref": "#/$defs/Priority", "description": "How urgent"}
+					},
+					"required": ["priority"],
+					"title": "create_issueArguments",
+					"description": "Create an issue",
+					"type": "object"
+				}
+			}`,
+			expectedToolInfo: fantasy.ToolInfo{
+				Name:        "create_issue",
+				Description: "Create an issue",
+				Parameters: map[string]any{
+					"labels": map[string]any{
+						"items": map[string]any{"properties": map[string]any{"name": map[string]any{"type": "string"}}, "required": []any{"name"}, "title": "Label", "type": "object"},
+						"type":  "array",
+					},
+					"priority": map[string]any{"enum": []any{"low", "high"}, "title": "Priority", "type": "string", "description": "How urgent"},
+				},
+				Required: []string{"priority"},
+			},
+		},
+		{
+			name: "zod definitions with a root $ref",
+			tool: `{
+				"name": "search",
+				"description": "Search",
+				"inputSchema": {
+					"$ref": "#/definitions/search",
+					"definitions": {
+						"search": {"type": "object", "properties": {"query": {"type": "string"}}, "required": ["query"], "additionalProperties": false}
+					},
+					"$schema": "http://json-schema.org/draft-07/schema#"
+				}
+			}`,
+			expectedToolInfo: fantasy.ToolInfo{
+				Name:        "search",
+				Description: "Search",
+				Parameters:  map[string]any{"query": map[string]any{"type": "string"}},
+				Required:    []string{"query"},
+			},
+		},
+		{
+			name: "recursive schema",
+			tool: `{
+				"name": "save_tree",
+				"description": "Save a tree",
+				"inputSchema": {
+					"type": "object",
+					"properties": {"root": {"$ref": "#/$defs/Node"}},
+					"$defs": {"Node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/Node"}}}}}
+				}
+			}`,
+			expectedToolInfo: fantasy.ToolInfo{
+				Name:        "save_tree",
+				Description: "Save a tree",
+				Parameters: map[string]any{
+					"root": map[string]any{"type": "object", "properties": map[string]any{
+						"children": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+					}},
+				},
+				Required: []string{},
+			},
+		},
+		{
+			name: "root alternatives",
+			tool: `{
+				"name": "get_user",
+				"description": "Get a user by id or email",
+				"inputSchema": {
+					"type": "object",
+					"properties": {"verbose": {"type": "boolean"}},
+					"anyOf": [
+						{"properties": {"id": {"type": "integer"}, "tenant": {"type": "string"}}, "required": ["id", "tenant"]},
+						{"properties": {"email": {"type": "string"}, "tenant": {"type": "string"}}, "required": ["email", "tenant"]}
+					]
+				}
+			}`,
+			expectedToolInfo: fantasy.ToolInfo{
+				Name:        "get_user",
+				Description: "Get a user by id or email",
+				Parameters: map[string]any{
+					"verbose": map[string]any{"type": "boolean"},
+					"id":      map[string]any{"type": "integer"},
+					"email":   map[string]any{"type": "string"},
+					"tenant":  map[string]any{"type": "string"},
+				},
+				Required: []string{"tenant"},
+			},
+		},
+		{
+			name: "downgraded for a restrictive provider",
+			tool: `{
+				"name": "set_mode",
+				"description": "Set the mode",
+				"inputSchema": {
+					"type": "object",
+					"properties": {
+						"mode": {"const": "fast"},
+						"options": {"type": "object", "additionalProperties": {"type": "string"}}
+					}
+				}
+			}`,
+			options: MCPSchemaOptions{StripKeywords: []string{"additionalProperties"}, ConstToEnum: true},
+			expectedToolInfo: fantasy.ToolInfo{
+				Name:        "set_mode",
+				Description: "Set the mode",
+				Parameters: map[string]any{
+					"mode":    map[string]any{"enum": []any{"fast"}},
+					"options": map[string]any{"type": "object"},
+				},
+				Required: []string{},
+			},
+		},
+		{
+			name: "parameters named after keywords",
+			tool: `{
+				"name": "define_word",
+				"description": "Define a word",
+				"inputSchema": {
+					"type": "object",
+					"properties": {
+						"definitions": {"type": "array", "items": {"type": "string"}},
+						"const": {"type": "string", "const": "noun"},
+						"additionalProperties": {"type": "object", "additionalProperties": false},
+						"$ref": {"type": "string"}
+					},
+					"required": ["definitions", "const"]
+				}
+			}`,
+			options: MCPSchemaOptions{StripKeywords: []string{"additionalProperties"}, ConstToEnum: true},
+			expectedToolInfo: fantasy.ToolInfo{
+				Name:        "define_word",
+				Description: "Define a word",
+				Parameters: map[string]any{
+					"definitions":          map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+					"const":                map[string]any{"type": "string", "enum": []any{"noun"}},
+					"additionalProperties": map[string]any{"type": "object"},
+					"$ref":                 map[string]any{"type": "string"},
+				},
+				Required: []string{"definitions", "const"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			var mcpTool *mcp.Tool
+			if err := json.Unmarshal([]byte(tt.tool), &mcpTool); err != nil {
+				t.Fatalf("failed to unmarshal tool: %v", err)
+			}
+
+			// When
+			toolInfo, err := toolInfoFromMCPTool(mcpTool, tt.options)
+			if err != nil {
+				t.Fatalf("failed to get tool info: %v", err)
+			}
+
+			// Then
+			if !reflect.DeepEqual(toolInfo, tt.expectedToolInfo) {
+				t.Fatalf("tool info does not match expected tool info:\n got: %#v\nwant: %#v", toolInfo, tt.expectedToolInfo)
+			}
+		})
+	}
+}
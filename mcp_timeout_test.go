@@ -0,0 +1,113 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newBlockingMCPServer returns a server whose "crawl" tool runs until cancelled, reporting
+// cancellations on the returned channel, and whose "quick" tool returns immediately.
+func newBlockingMCPServer() (*mcp.Server, chan struct{}) {
+	cancelled := make(chan struct{}, 1)
+	server := mcp.NewServer(&mcp.Implementation{Name: "crawler", Version: "1.0.0"}, nil)
+	emptySchema := map[string]any{"type": "object"}
+	server.AddTool(&mcp.Tool{Name: "crawl", InputSchema: emptySchema}, func(ctx context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		<-ctx.Done()
+		cancelled <- struct{}{}
+		return nil, ctx.Err()
+	})
+	server.AddTool(&mcp.Tool{Name: "quick", InputSchema: emptySchema}, func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil
+	})
+	return server, cancelled
+}
+
+func TestMCPTools_Timeouts(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name            string
+		options         MCPToolsOptions
+		tool            string
+		expectedTimeout bool
+	}{
+		{name: "server timeout", options: MCPToolsOptions{Timeout: 50 * time.Millisecond}, tool: "crawl", expectedTimeout: true},
+		{name: "tool timeout", options: MCPToolsOptions{ToolTimeouts: map[string]time.Duration{"crawl": 50 * time.Millisecond}}, tool: "crawl", expectedTimeout: true},
+		{name: "tool timeout overrides server timeout", options: MCPToolsOptions{
+			Timeout:      time.Hour,
+			ToolTimeouts: map[string]time.Duration{"crawl": 50 * time.Millisecond},
+		}, tool: "crawl", expectedTimeout: true},
+		{name: "fast tool within timeout", options: MCPToolsOptions{Timeout: 5 * time.Second}, tool: "quick"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// Given
+			server, cancelled := newBlockingMCPServer()
+			sessionMaker, _ := newTestMCPSessionMaker(t, server, nil)
+			tools := mcpToolsByName(t, sessionMaker, tt.options)
+
+			// When
+			resp, err := tools[tt.tool].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: tt.tool, Input: "{}"})
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			toolErr := MCPToolResponseError(resp)
+			if !tt.expectedTimeout {
+				if toolErr != nil {
+					t.Fatalf("unexpected tool error: %v", toolErr)
+				}
+				return
+			}
+			if !errors.Is(toolErr, ErrMCPTimeout) {
+				t.Fatalf("expected a timeout error, got %v", toolErr)
+			}
+			if !strings.Contains(resp.Content, "did not complete within 50ms") {
+				t.Fatalf("expected the timeout to be explained, got %q", resp.Content)
+			}
+			select {
+			case <-cancelled:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected the server to be told to cancel the call")
+			}
+		})
+	}
+}
+
+func TestMCPTools_CancellationReachesServer(t *testing.T) {
+	t.Parallel()
+	// Given
+	server, cancelled := newBlockingMCPServer()
+	sessionMaker, _ := newTestMCPSessionMaker(t, server, nil)
+	pool := NewMCPSessionPool(sessionMaker, MCPSessionPoolOptions{})
+	t.Cleanup(func() { _ = pool.Close() })
+	tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{SessionPool: pool})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	// When
+	resp, err := tools["crawl"].Run(ctx, fantasy.ToolCall{ID: "call-1", Name: "crawl", Input: "{}"})
+
+	// Then
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if toolErr := MCPToolResponseError(resp); !errors.Is(toolErr, ErrMCPCancelled) {
+		t.Fatalf("expected a cancellation error, got %v", toolErr)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the server to be told to cancel the call")
+	}
+}
@@ -0,0 +1,170 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"charm.land/fantasy"
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	defaultMCPServerName    = "fantasy-extensions"
+	defaultMCPServerVersion = "1.0.0"
+)
+
+type MCPToolServerOptions struct {
+	// Implementation identifies the server to its clients. Defaults to "fantasy-extensions" 1.0.0.
+	Implementation *mcp.Implementation
+	// ServerOptions are passed to mcp.NewServer.
+	ServerOptions *mcp.ServerOptions
+}
+
+// NewMCPToolServer returns an MCP server publishing tools, so that they can be used by any MCP client.
+// Serve it with ServeMCPStdio or MCPHTTPHandler.
+//
+// Tool responses become text content. Media and structured content recorded in the response
+// metadata by tools obtained from MCP servers are passed on as such, as are their annotations and
+// output schemas. Progress reported through WithMCPProgress is sent to clients that ask for it.
+func NewMCPToolServer(tools []fantasy.AgentTool, options MCPToolServerOptions) *mcp.Server {
+	implementation := options.Implementation
+	if implementation == nil {
+		implementation = &mcp.Implementation{Name: defaultMCPServerName, Version: defaultMCPServerVersion}
+	}
+	server := mcp.NewServer(implementation, options.ServerOptions)
+	AddToolsToMCPServer(server, tools...)
+	return server
+}
+
+// AddToolsToMCPServer adds tools to server, replacing tools of the same name.
+func AddToolsToMCPServer(server *mcp.Server, tools ...fantasy.AgentTool) {
+	for _, tool := range tools {
+		server.AddTool(mcpServerTool(tool), mcpServerToolHandler(tool))
+	}
+}
+
+// ServeMCPStdio serves server over standard input and output until ctx is done or the client
+// disconnects.
+func ServeMCPStdio(ctx context.Context, server *mcp.Server) error {
+	return server.Run(ctx, &mcp.StdioTransport{})
+}
+
+// MCPHTTPHandler serves server over the streamable HTTP transport.
+func MCPHTTPHandler(server *mcp.Server, options *mcp.StreamableHTTPOptions) http.Handler {
+	return mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, options)
+}
+
+// MCPToolFetcherHTTPHandler serves the tools returned by toolFetcher over the streamable HTTP
+// transport. The fetcher is called with the context of the request starting each session (or of
+// every request, if stateless), so tools can depend on what middleware put in it, e.g. the caller's
+// identity. Over stdio there is a single client: pass toolFetcher(ctx) to NewMCPToolServer.
+func MCPToolFetcherHTTPHandler(toolFetcher ToolFetcher, options MCPToolServerOptions, httpOptions *mcp.StreamableHTTPOptions) http.Handler {
+	return mcp.NewStreamableHTTPHandler(func(r *http.Request) *mcp.Server {
+		return NewMCPToolServer(toolFetcher(r.Context()), options)
+	}, httpOptions)
+}
+
+// mcpServerTool converts a tool's info back into an MCP tool definition.
+func mcpServerTool(tool fantasy.AgentTool) *mcp.Tool {
+	info := tool.Info()
+	properties := info.Parameters
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	inputSchema := map[string]any{"type": "object", "properties": properties}
+	if len(info.Required) > 0 {
+		inputSchema["required"] = info.Required
+	}
+	mcpTool := &mcp.Tool{Name: info.Name, Description: info.Description, InputSchema: inputSchema}
+	if t, ok := tool.(MCPAgentTool); ok {
+		mcpTool.Annotations = t.Annotations()
+		if outputSchema := t.OutputSchema(); outputSchema != nil {
+			mcpTool.OutputSchema = outputSchema
+		}
+		if upstream := t.MCPTool(); upstream != nil {
+			mcpTool.Title = upstream.Title
+		}
+	}
+	return mcpTool
+}
+
+func mcpServerToolHandler(tool fantasy.AgentTool) mcp.ToolHandler {
+	name := tool.Info().Name
+	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		input := "{}"
+		if len(req.Params.Arguments) > 0 {
+			input = string(req.Params.Arguments)
+		}
+		resp, err := tool.Run(withMCPProgressForwarding(ctx, req, name), fantasy.ToolCall{ID: uuid.NewString(), Name: name, Input: input})
+		if err != nil {
+			return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}}}, nil
+		}
+		return mcpServerToolResult(resp), nil
+	}
+}
+
+// withMCPProgressForwarding returns a context whose MCPProgressFunc sends progress notifications to
+// the client that made req, if it asked for them.
+func withMCPProgressForwarding(ctx context.Context, req *mcp.CallToolRequest, name string) context.Context {
+	token := req.Params.GetProgressToken()
+	if token == nil {
+		return ctx
+	}
+	return WithMCPProgress(ctx, func(ctx context.Context, progress MCPProgress) {
+		err := req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: token,
+			Progress:      progress.Progress,
+			Total:         progress.Total,
+			Message:       progress.Message,
+		})
+		if err != nil {
+			log.Printf("failed to notify progress of tool %s: %v", name, err)
+		}
+	})
+}
+
+// mcpServerToolResult converts a tool response into an MCP tool result.
+func mcpServerToolResult(resp fantasy.ToolResponse) *mcp.CallToolResult {
+	result := &mcp.CallToolResult{IsError: resp.IsError, Content: []mcp.Content{}}
+	if resp.Content != "" {
+		result.Content = append(result.Content, &mcp.TextContent{Text: resp.Content})
+	}
+	if resp.Metadata == "" {
+		return result
+	}
+	var metadata struct {
+		Media             []MCPToolMedia `json:"media"`
+		StructuredContent any            `json:"structured_content"`
+	}
+	if err := json.Unmarshal([]byte(resp.Metadata), &metadata); err != nil {
+		// metadata of tools other than MCP tools may be of any shape
+		return result
+	}
+	for _, media := range metadata.Media {
+		data, err := base64.StdEncoding.DecodeString(media.Data)
+		if err != nil {
+			log.Printf("failed to decode %s media of tool response: %v", media.MediaType, err)
+			continue
+		}
+		switch media.Type {
+		case "image":
+			result.Content = append(result.Content, &mcp.ImageContent{Data: data, MIMEType: media.MediaType})
+		case "audio":
+			result.Content = append(result.Content, &mcp.AudioContent{Data: data, MIMEType: media.MediaType})
+		default:
+			result.Content = append(result.Content, &mcp.EmbeddedResource{Resource: &mcp.ResourceContents{
+				URI:      "media:" + uuid.NewString(),
+				MIMEType: media.MediaType,
+				Blob:     data,
+			}})
+		}
+	}
+	if !resp.IsError {
+		result.StructuredContent = metadata.StructuredContent
+	}
+	return result
+}
@@ -0,0 +1,240 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type addInput struct {
+	A int `json:"a" description:"first operand"`
+	B int `json:"b" description:"second operand"`
+}
+
+func newCalculatorTools() []fantasy.AgentTool {
+	return []fantasy.AgentTool{
+		fantasy.NewAgentTool("add", "Add two numbers", func(_ context.Context, input addInput, _ fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			return fantasy.NewTextResponse(fmt.Sprint(input.A + input.B)), nil
+		}),
+		fantasy.NewAgentTool("divide", "Divide two numbers", func(_ context.Context, input addInput, _ fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if input.B == 0 {
+				return fantasy.NewTextErrorResponse("division by zero"), nil
+			}
+			return fantasy.NewTextResponse(fmt.Sprint(input.A / input.B)), nil
+		}),
+		fantasy.NewAgentTool("explode", "Always fails", func(context.Context, struct{}, fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			return fantasy.ToolResponse{}, errors.New("boom")
+		}),
+	}
+}
+
+func connectMCPServer(t *testing.T, server *mcp.Server, clientOptions *mcp.ClientOptions) *mcp.ClientSession {
+	t.Helper()
+	sessionMaker, _ := newTestMCPSessionMaker(t, server, clientOptions)
+	session, err := sessionMaker(context.Background())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+	return session
+}
+
+func TestNewMCPToolServer_PublishesToolSchemas(t *testing.T) {
+	t.Parallel()
+	// Given
+	session := connectMCPServer(t, NewMCPToolServer(newCalculatorTools(), MCPToolServerOptions{}), nil)
+
+	// When
+	result, err := session.ListTools(context.Background(), nil)
+
+	// Then
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	if len(result.Tools) != 3 {
+		t.Fatalf("expected 3 tools, got %d", len(result.Tools))
+	}
+	var add *mcp.Tool
+	for _, tool := range result.Tools {
+		if tool.Name == "add" {
+			add = tool
+		}
+	}
+	schema := add.InputSchema.(map[string]any)
+	if add.Description != "Add two numbers" || schema["type"] != "object" || !reflect.DeepEqual(schema["required"], []any{"a", "b"}) {
+		t.Fatalf("unexpected tool definition: %+v %v", add, schema)
+	}
+	if a := schema["properties"].(map[string]any)["a"].(map[string]any); a["type"] != "integer" || a["description"] != "first operand" {
+		t.Fatalf("unexpected property schema: %v", a)
+	}
+}
+
+func TestNewMCPToolServer_CallsTools(t *testing.T) {
+	t.Parallel()
+	session := connectMCPServer(t, NewMCPToolServer(newCalculatorTools(), MCPToolServerOptions{}), nil)
+	tests := []struct {
+		name            string
+		tool            string
+		arguments       any
+		expectedText    string
+		expectedIsError bool
+	}{
+		{name: "success", tool: "add", arguments: map[string]any{"a": 2, "b": 3}, expectedText: "5"},
+		{name: "error response", tool: "divide", arguments: map[string]any{"a": 2, "b": 0}, expectedText: "division by zero", expectedIsError: true},
+		{name: "run error", tool: "explode", expectedText: "boom", expectedIsError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// When
+			result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: tt.tool, Arguments: tt.arguments})
+
+			// Then
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError != tt.expectedIsError || len(result.Content) != 1 || result.Content[0].(*mcp.TextContent).Text != tt.expectedText {
+				t.Fatalf("expected %q (is error: %v), got %+v", tt.expectedText, tt.expectedIsError, result)
+			}
+		})
+	}
+}
+
+func TestNewMCPToolServer_RepublishesMCPTools(t *testing.T) {
+	t.Parallel()
+	// Given
+	screenshotMaker, _ := newTestMCPSessionMaker(t, newScreenshotMCPServer(t), nil)
+	weatherMaker, _ := newTestMCPSessionMaker(t, newWeatherMCPServer(), nil)
+	tools, err := MCPMultiServerTools(context.Background(), []MCPServer{
+		{Name: "shots", SessionMaker: screenshotMaker},
+		{Name: "weather", SessionMaker: weatherMaker},
+	}, MCPMultiServerOptions{})
+	if err != nil {
+		t.Fatalf("failed to list upstream tools: %v", err)
+	}
+	session := connectMCPServer(t, NewMCPToolServer(tools, MCPToolServerOptions{}), nil)
+
+	// When
+	screenshot, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "shots__screenshot", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	forecast, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "weather__forecast", Arguments: map[string]any{"city": "Paris"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Then
+	if len(screenshot.Content) != 3 {
+		t.Fatalf("expected text, image and audio content, got %+v", screenshot.Content)
+	}
+	if image, ok := screenshot.Content[1].(*mcp.ImageContent); !ok || image.MIMEType != "image/png" {
+		t.Fatalf("expected the image to be passed on, got %+v", screenshot.Content[1])
+	}
+	if audio, ok := screenshot.Content[2].(*mcp.AudioContent); !ok || string(audio.Data) != "RIFF....WAVE" {
+		t.Fatalf("expected the audio to be passed on, got %+v", screenshot.Content[2])
+	}
+	if structured, ok := forecast.StructuredContent.(map[string]any); !ok || structured["temperature"] != 21.5 {
+		t.Fatalf("expected the structured content to be passed on, got %+v", forecast.StructuredContent)
+	}
+}
+
+func TestNewMCPToolServer_ForwardsProgress(t *testing.T) {
+	t.Parallel()
+	// Given
+	tools, err := MCPTools(context.Background(), newProgressMCPSessionMaker(t, 3))
+	if err != nil {
+		t.Fatalf("failed to list upstream tools: %v", err)
+	}
+	var notifications atomic.Int32
+	session := connectMCPServer(t, NewMCPToolServer(tools, MCPToolServerOptions{}), &mcp.ClientOptions{
+		ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+			if req.Params.ProgressToken == "token-1" && req.Params.Total == 3 {
+				notifications.Add(1)
+			}
+		},
+	})
+	params := &mcp.CallToolParams{Name: "index", Arguments: map[string]any{}, Meta: mcp.Meta{}}
+	params.SetProgressToken("token-1")
+
+	// When
+	result, err := session.CallTool(context.Background(), params)
+
+	// Then
+	if err != nil || result.IsError {
+		t.Fatalf("unexpected error: %v %+v", err, result)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for notifications.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := notifications.Load(); n != 3 {
+		t.Fatalf("expected 3 progress notifications, got %d", n)
+	}
+}
+
+func TestMCPHTTPHandler(t *testing.T) {
+	t.Parallel()
+	// Given
+	httpServer := httptest.NewServer(MCPHTTPHandler(NewMCPToolServer(newCalculatorTools(), MCPToolServerOptions{}), nil))
+	t.Cleanup(httpServer.Close)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+	sessionMaker := func(ctx context.Context) (*mcp.ClientSession, error) {
+		return client.Connect(ctx, &mcp.StreamableClientTransport{Endpoint: httpServer.URL}, nil)
+	}
+	tools := mcpToolsByName(t, sessionMaker, MCPToolsOptions{})
+
+	// When
+	resp, err := tools["add"].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: "add", Input: `{"a": 20, "b": 22}`})
+
+	// Then
+	if err != nil || resp.IsError || resp.Content != "42" {
+		t.Fatalf("unexpected response: %v %+v", err, resp)
+	}
+}
+
+func TestMCPToolFetcherHTTPHandler_FetchesToolsPerSession(t *testing.T) {
+	t.Parallel()
+	// Given
+	type roleKey struct{}
+	toolFetcher := func(ctx context.Context) []fantasy.AgentTool {
+		tools := newCalculatorTools()
+		if ctx.Value(roleKey{}) != "admin" {
+			return tools[:1]
+		}
+		return tools
+	}
+	handler := MCPToolFetcherHTTPHandler(toolFetcher, MCPToolServerOptions{}, nil)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), roleKey{}, r.URL.Query().Get("role"))))
+	}))
+	t.Cleanup(httpServer.Close)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+	sessionMaker := func(role string) MCPSessionMaker {
+		return func(ctx context.Context) (*mcp.ClientSession, error) {
+			return client.Connect(ctx, &mcp.StreamableClientTransport{Endpoint: httpServer.URL + "?role=" + role}, nil)
+		}
+	}
+
+	// When
+	adminTools := mcpToolsByName(t, sessionMaker("admin"), MCPToolsOptions{})
+	guestTools := mcpToolsByName(t, sessionMaker("guest"), MCPToolsOptions{})
+
+	// Then
+	if len(adminTools) != 3 || len(guestTools) != 1 || guestTools["add"] == nil {
+		t.Fatalf("unexpected tools: admin=%v guest=%v", adminTools, guestTools)
+	}
+	resp, err := guestTools["add"].Run(context.Background(), fantasy.ToolCall{ID: "call-1", Name: "add", Input: `{"a": 20, "b": 22}`})
+	if err != nil || resp.IsError || resp.Content != "42" {
+		t.Fatalf("unexpected response: %v %+v", err, resp)
+	}
+}
@@ -0,0 +1,268 @@
+package fantasyextensions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const defaultMCPToolsetRefreshTimeout = 30 * time.Second
+
+type MCPToolsetOptions struct {
+	MCPToolsOptions
+	// OnChange is called after a tools/list_changed notification, or a reconnect, has been applied.
+	OnChange func(MCPToolsetChange)
+	// OnError is called when the watch session is lost or re-listing tools fails. The previous
+	// tools remain in place. If nil, errors are logged.
+	OnError func(error)
+	// RefreshTimeout bounds each re-listing done in the background. Defaults to 30 seconds.
+	RefreshTimeout time.Duration
+}
+
+// MCPToolsetChange describes how the tools exposed by a server changed, by tool name.
+type MCPToolsetChange struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// MCPToolset is a live view of the tools exposed by an MCP server. It keeps a session open to
+// receive tools/list_changed notifications and re-lists tools whenever one arrives. If the session
+// is lost, e.g. because the server crashed, it reconnects with backoff and re-lists tools.
+//
+// Notifications are only delivered if the client used by the session maker is configured with
+// MCPToolListChangedHandler:
+//
+//	client := mcp.NewClient(impl, &mcp.ClientOptions{
+//		ToolListChangedHandler: fantasyextensions.MCPToolListChangedHandler,
+//	})
+type MCPToolset struct {
+	sessionMaker MCPSessionMaker
+	sessions     mcpSessionProvider
+	options      MCPToolsetOptions
+
+	refreshMu sync.Mutex
+	watch     *mcp.ClientSession
+	// stop is closed by Close to end reconnecting
+	stop chan struct{}
+
+	mu       sync.RWMutex
+	mcpTools map[string]*mcp.Tool
+	tools    []fantasy.AgentTool
+}
+
+func NewMCPToolset(ctx context.Context, sessionMaker MCPSessionMaker, options MCPToolsetOptions) (*MCPToolset, error) {
+	ts := &MCPToolset{
+		sessionMaker: sessionMaker,
+		sessions:     newMCPSessionProvider(sessionMaker, options.MCPToolsOptions),
+		options:      options,
+		stop:         make(chan struct{}),
+	}
+	if ts.options.RefreshTimeout <= 0 {
+		ts.options.RefreshTimeout = defaultMCPToolsetRefreshTimeout
+	}
+	if _, err := ts.Refresh(ctx); err != nil {
+		ts.Close()
+		return nil, err
+	}
+	return ts, nil
+}
+
+// Tools returns the current tools. Its signature matches ToolFetcher.
+func (ts *MCPToolset) Tools(_ context.Context) []fantasy.AgentTool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	result := make([]fantasy.AgentTool, len(ts.tools))
+	copy(result, ts.tools)
+	return result
+}
+
+// Refresh re-lists tools from the server, reconnecting the watch session if needed.
+func (ts *MCPToolset) Refresh(ctx context.Context) (MCPToolsetChange, error) {
+	ts.refreshMu.Lock()
+	defer ts.refreshMu.Unlock()
+
+	mcpTools, err := ts.listTools(ctx)
+	if err != nil && isMCPTransportError(err) {
+		ts.closeWatch()
+		mcpTools, err = ts.listTools(ctx)
+	}
+	if err != nil {
+		return MCPToolsetChange{}, err
+	}
+	tools, err := fantasyToolsFromMCPTools(mcpTools, ts.sessions, ts.options.MCPToolsOptions)
+	if err != nil {
+		return MCPToolsetChange{}, err
+	}
+
+	byName := make(map[string]*mcp.Tool, len(mcpTools))
+	for _, tool := range mcpTools {
+		byName[tool.Name] = tool
+	}
+	ts.mu.Lock()
+	change := diffMCPDefinitions(ts.mcpTools, byName)
+	ts.mcpTools = byName
+	ts.tools = tools
+	ts.mu.Unlock()
+	return change, nil
+}
+
+// Close stops watching for changes. Tools remain usable.
+func (ts *MCPToolset) Close() {
+	ts.refreshMu.Lock()
+	defer ts.refreshMu.Unlock()
+	select {
+	case <-ts.stop:
+	default:
+		close(ts.stop)
+	}
+	ts.closeWatch()
+}
+
+func (ts *MCPToolset) listTools(ctx context.Context) ([]*mcp.Tool, error) {
+	if ts.watch == nil {
+		session, err := ts.sessionMaker(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errMCPSessionCreation, err)
+		}
+		ts.watch = session
+		registerMCPToolset(session, ts)
+		go ts.watchSession(session)
+	}
+	return listMCPTools(ctx, ts.watch, ts.options.MCPToolsOptions)
+}
+
+func (ts *MCPToolset) closeWatch() {
+	if ts.watch == nil {
+		return
+	}
+	unregisterMCPToolset(ts.watch)
+	_ = ts.watch.Close()
+	ts.watch = nil
+}
+
+// watchSession reconnects once session is lost, unless it was closed on purpose.
+func (ts *MCPToolset) watchSession(session *mcp.ClientSession) {
+	err := session.Wait()
+	for retry := 1; ; retry++ {
+		ts.refreshMu.Lock()
+		lost := ts.watch == session
+		if lost {
+			ts.closeWatch()
+		}
+		ts.refreshMu.Unlock()
+		if !lost {
+			return
+		}
+		if retry == 1 {
+			ts.reportError(fmt.Errorf("MCP toolset lost its watch session: %w", errors.Join(mcp.ErrConnectionClosed, err)))
+		}
+		delay, _ := MCPRetryPolicy{}.backoff(retry, 0)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ts.stop:
+			timer.Stop()
+			return
+		}
+		if ts.refresh() {
+			return
+		}
+		// a failed refresh may have left a new session behind, which is replaced on the next attempt
+		session = ts.currentWatch()
+	}
+}
+
+func (ts *MCPToolset) currentWatch() *mcp.ClientSession {
+	ts.refreshMu.Lock()
+	defer ts.refreshMu.Unlock()
+	return ts.watch
+}
+
+func (ts *MCPToolset) onToolListChanged() {
+	ts.refresh()
+}
+
+// refresh re-lists tools in the background, reporting the outcome. It reports whether it succeeded.
+func (ts *MCPToolset) refresh() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), ts.options.RefreshTimeout)
+	defer cancel()
+	change, err := ts.Refresh(ctx)
+	if err != nil {
+		ts.reportError(err)
+		return false
+	}
+	if ts.options.OnChange != nil {
+		ts.options.OnChange(change)
+	}
+	return true
+}
+
+func (ts *MCPToolset) reportError(err error) {
+	if ts.options.OnError != nil {
+		ts.options.OnError(err)
+	} else {
+		log.Printf("error refreshing MCP tools: %v", err)
+	}
+}
+
+// diffMCPDefinitions compares tools, resources or prompts by name.
+func diffMCPDefinitions[T any](before, after map[string]T) MCPToolsetChange {
+	var change MCPToolsetChange
+	for name, tool := range after {
+		previous, ok := before[name]
+		if !ok {
+			change.Added = append(change.Added, name)
+			continue
+		}
+		previousJSON, _ := json.Marshal(previous)
+		toolJSON, _ := json.Marshal(tool)
+		if string(previousJSON) != string(toolJSON) {
+			change.Changed = append(change.Changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			change.Removed = append(change.Removed, name)
+		}
+	}
+	return change
+}
+
+var (
+	mcpToolsetsMu sync.Mutex
+	mcpToolsets   = map[*mcp.ClientSession]*MCPToolset{}
+)
+
+func registerMCPToolset(session *mcp.ClientSession, ts *MCPToolset) {
+	mcpToolsetsMu.Lock()
+	defer mcpToolsetsMu.Unlock()
+	mcpToolsets[session] = ts
+}
+
+func unregisterMCPToolset(session *mcp.ClientSession) {
+	mcpToolsetsMu.Lock()
+	defer mcpToolsetsMu.Unlock()
+	delete(mcpToolsets, session)
+}
+
+// MCPToolListChangedHandler refreshes the MCPToolset or MCPGateway watching the session the
+// notification arrived on.
+// Use it as mcp.ClientOptions.ToolListChangedHandler.
+func MCPToolListChangedHandler(_ context.Context, req *mcp.ToolListChangedRequest) {
+	mcpToolsetsMu.Lock()
+	ts, ok := mcpToolsets[req.Session]
+	mcpToolsetsMu.Unlock()
+	if ok {
+		// re-listing must not block the session's notification handling
+		go ts.onToolListChanged()
+	}
+	refreshMCPGatewayUpstream(req.Session)
+}
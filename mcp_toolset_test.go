@@ -0,0 +1,104 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestMCPToolset_ReactsToToolListChanged(t *testing.T) {
+	t.Parallel()
+	// Given
+	server := newEchoMCPServer()
+	sessionMaker, _ := newTestMCPSessionMaker(t, server, &mcp.ClientOptions{
+		ToolListChangedHandler: MCPToolListChangedHandler,
+	})
+	changes := make(chan MCPToolsetChange, 1)
+	toolset, err := NewMCPToolset(context.Background(), sessionMaker, MCPToolsetOptions{
+		OnChange: func(change MCPToolsetChange) { changes <- change },
+	})
+	if err != nil {
+		t.Fatalf("failed to create toolset: %v", err)
+	}
+	defer toolset.Close()
+	var toolFetcher ToolFetcher = toolset.Tools
+	if got := len(toolFetcher(context.Background())); got != 1 {
+		t.Fatalf("expected 1 tool, got %d", got)
+	}
+
+	// When
+	mcp.AddTool(server, &mcp.Tool{Name: "shout", Description: "Shout the message"}, func(_ context.Context, _ *mcp.CallToolRequest, input echoInput) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: input.Message + "!"}}}, nil, nil
+	})
+
+	// Then
+	select {
+	case change := <-changes:
+		if !reflect.DeepEqual(change, MCPToolsetChange{Added: []string{"shout"}}) {
+			t.Fatalf("unexpected change: %+v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for tools to change")
+	}
+	if got := len(toolFetcher(context.Background())); got != 2 {
+		t.Fatalf("expected 2 tools, got %d", got)
+	}
+}
+
+func TestMCPToolset_ReconnectsWhenTheWatchSessionIsLost(t *testing.T) {
+	t.Parallel()
+	// Given
+	server := newEchoMCPServer()
+	sessionMaker, connections := newTestMCPSessionMaker(t, server, &mcp.ClientOptions{
+		ToolListChangedHandler: MCPToolListChangedHandler,
+	})
+	changes := make(chan MCPToolsetChange, 2)
+	errs := make(chan error, 1)
+	toolset, err := NewMCPToolset(context.Background(), sessionMaker, MCPToolsetOptions{
+		OnChange: func(change MCPToolsetChange) { changes <- change },
+		OnError:  func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatalf("failed to create toolset: %v", err)
+	}
+	defer toolset.Close()
+
+	// When
+	_ = toolset.currentWatch().Close()
+
+	// Then
+	select {
+	case err := <-errs:
+		if !errors.Is(err, mcp.ErrConnectionClosed) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the lost session to be reported")
+	}
+	select {
+	case change := <-changes:
+		if !reflect.DeepEqual(change, MCPToolsetChange{}) {
+			t.Fatalf("unexpected change: %+v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the toolset to reconnect")
+	}
+	if got := connections.Load(); got != 2 {
+		t.Fatalf("expected 2 sessions to be created, got %d", got)
+	}
+	mcp.AddTool(server, &mcp.Tool{Name: "shout", Description: "Shout the message"}, func(_ context.Context, _ *mcp.CallToolRequest, input echoInput) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: input.Message + "!"}}}, nil, nil
+	})
+	select {
+	case change := <-changes:
+		if !reflect.DeepEqual(change, MCPToolsetChange{Added: []string{"shout"}}) {
+			t.Fatalf("unexpected change: %+v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for tools to change after reconnecting")
+	}
+}
@@ -0,0 +1,187 @@
+package fantasyextensions
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+type MCPArgumentValidation uint8
+
+const (
+	// MCPArgumentValidationOff forwards arguments to the server as is, leaving validation to it.
+	MCPArgumentValidationOff MCPArgumentValidation = iota
+	// MCPArgumentValidationStrict rejects arguments that don't match the tool's input schema
+	// without calling the server.
+	MCPArgumentValidationStrict
+	// MCPArgumentValidationLenient coerces common mistakes (stringified numbers, booleans,
+	// objects and arrays) before validating.
+	MCPArgumentValidationLenient
+)
+
+// resolveMCPValidationSchema prepares a tool's input or output schema for validation. Schemas
+// declaring an older draft are validated as 2020-12, which agrees with them on the keywords tools
+// use in practice.
+func resolveMCPValidationSchema(schema any) (*jsonschema.Resolved, error) {
+	if schema == nil {
+		schema = map[string]any{"type": "object"}
+	}
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var s jsonschema.Schema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	s.Schema = ""
+	return s.Resolve(nil)
+}
+
+// validateMCPArguments checks input against the tool's input schema. It returns the arguments to
+// send, which differ from input only when lenient coercion changed something.
+func validateMCPArguments(input string, schema *jsonschema.Resolved, mode MCPArgumentValidation) (string, error) {
+	if mode == MCPArgumentValidationOff || schema == nil {
+		return input, nil
+	}
+	if strings.TrimSpace(input) == "" {
+		input = "{}"
+	}
+	var args any
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return input, fmt.Errorf("arguments are not valid JSON: %w", err)
+	}
+	err := schema.Validate(args)
+	if err == nil || mode != MCPArgumentValidationLenient {
+		return input, err
+	}
+	coerced, ok := coerceMCPArguments(args, schema.Schema(), schema.Schema())
+	if !ok || schema.Validate(coerced) != nil {
+		return input, err
+	}
+	b, marshalErr := json.Marshal(coerced)
+	if marshalErr != nil {
+		return input, err
+	}
+	return string(b), nil
+}
+
+// validateMCPStructuredContent checks structured tool output against the tool's output schema.
+func validateMCPStructuredContent(content any, schema *jsonschema.Resolved) error {
+	// round trip so that content has the same shape as decoded JSON
+	b, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("structured content is not valid JSON: %w", err)
+	}
+	var decoded any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return fmt.Errorf("structured content is not valid JSON: %w", err)
+	}
+	return schema.Validate(decoded)
+}
+
+// coerceMCPArguments converts strings holding numbers, booleans, objects or arrays where the schema
+// expects those types, as models often quote them. It reports whether anything changed.
+func coerceMCPArguments(value any, schema, root *jsonschema.Schema) (any, bool) {
+	schema = followMCPSchemaRef(schema, root)
+	if schema == nil {
+		return value, false
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		changed := false
+		for name, item := range v {
+			propertySchema := schema.Properties[name]
+			if propertySchema == nil {
+				propertySchema = schema.AdditionalProperties
+			}
+			var itemChanged bool
+			v[name], itemChanged = coerceMCPArguments(item, propertySchema, root)
+			changed = changed || itemChanged
+		}
+		return v, changed
+	case []any:
+		changed := false
+		for i, item := range v {
+			var itemChanged bool
+			v[i], itemChanged = coerceMCPArguments(item, schema.Items, root)
+			changed = changed || itemChanged
+		}
+		return v, changed
+	case string:
+		if coerced, ok := coerceMCPString(v, mcpSchemaTypes(schema)); ok {
+			coerced, _ = coerceMCPArguments(coerced, schema, root)
+			return coerced, true
+		}
+	}
+	return value, false
+}
+
+// followMCPSchemaRef returns the schema a local $ref points to, or schema itself if it has none.
+func followMCPSchemaRef(schema, root *jsonschema.Schema) *jsonschema.Schema {
+	// bounded, as refs may form a cycle
+	for range 32 {
+		if schema == nil || schema.Ref == "" {
+			return schema
+		}
+		if schema.Ref == "#" {
+			schema = root
+		} else if name, ok := strings.CutPrefix(schema.Ref, "#/$defs/"); ok {
+			schema = root.Defs[name]
+		} else if name, ok := strings.CutPrefix(schema.Ref, "#/definitions/"); ok {
+			schema = root.Definitions[name]
+		} else {
+			return nil
+		}
+	}
+	return nil
+}
+
+func coerceMCPString(s string, types []string) (any, bool) {
+	if len(types) == 0 || slices.Contains(types, "string") {
+		return nil, false
+	}
+	trimmed := strings.TrimSpace(s)
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if n, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+				return float64(n), true
+			}
+		case "number":
+			if n, err := strconv.ParseFloat(trimmed, 64); err == nil {
+				return n, true
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(trimmed); err == nil {
+				return b, true
+			}
+		case "object":
+			var object map[string]any
+			if err := json.Unmarshal([]byte(trimmed), &object); err == nil && object != nil {
+				return object, true
+			}
+		case "array":
+			var array []any
+			if err := json.Unmarshal([]byte(trimmed), &array); err == nil && array != nil {
+				return array, true
+			}
+		case "null":
+			if trimmed == "null" {
+				return nil, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func mcpSchemaTypes(schema *jsonschema.Schema) []string {
+	if schema.Type != "" {
+		return []string{schema.Type}
+	}
+	return schema.Types
+}
@@ -0,0 +1,119 @@
+package fantasyextensions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func Test_validateMCPArguments(t *testing.T) {
+	t.Parallel()
+	schema, err := resolveMCPValidationSchema(map[string]any{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type":    "object",
+		"properties": map[string]any{
+			"title":  map[string]any{"type": "string", "minLength": 1},
+			"count":  map[string]any{"type": "integer", "minimum": 1},
+			"draft":  map[string]any{"type": "boolean"},
+			"labels": map[string]any{"type": "array", "items": map[string]any{"type": "string", "enum": []any{"bug", "feature"}}},
+			"owner":  map[string]any{"$ref": "#/definitions/user"},
+		},
+		"required":             []any{"title"},
+		"additionalProperties": false,
+		"allOf":                []any{map[string]any{"not": map[string]any{"required": []any{"draft", "labels"}}}},
+		"definitions": map[string]any{
+			"user": map[string]any{"type": "object", "properties": map[string]any{"login": map[string]any{"type": "string"}}, "required": []any{"login"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to resolve schema: %v", err)
+	}
+	tests := []struct {
+		name          string
+		input         string
+		mode          MCPArgumentValidation
+		expectedInput string
+		expectedError string
+	}{
+		{
+			name:          "valid",
+			input:         `{"title": "Fix", "count": 2, "labels": ["bug"]}`,
+			mode:          MCPArgumentValidationStrict,
+			expectedInput: `{"title": "Fix", "count": 2, "labels": ["bug"]}`,
+		},
+		{name: "missing field", input: `{"count": 2}`, mode: MCPArgumentValidationStrict, expectedError: `missing properties: ["title"]`},
+		{name: "mistyped field", input: `{"title": "Fix", "count": "2"}`, mode: MCPArgumentValidationStrict, expectedError: `has type "string", want "integer"`},
+		{name: "enum", input: `{"title": "Fix", "labels": ["docs"]}`, mode: MCPArgumentValidationStrict, expectedError: "enum"},
+		{name: "referenced schema", input: `{"title": "Fix", "owner": {}}`, mode: MCPArgumentValidationStrict, expectedError: `missing properties: ["login"]`},
+		{name: "additional properties", input: `{"title": "Fix", "assignee": "octocat"}`, mode: MCPArgumentValidationStrict, expectedError: "additional properties"},
+		{name: "all of", input: `{"title": "Fix", "draft": true, "labels": []}`, mode: MCPArgumentValidationStrict, expectedError: "not"},
+		{
+			name:          "lenient coercion",
+			input:         `{"title": "Fix", "count": "2", "draft": "true", "owner": "{\"login\": \"octocat\"}"}`,
+			mode:          MCPArgumentValidationLenient,
+			expectedInput: `{"count":2,"draft":true,"owner":{"login":"octocat"},"title":"Fix"}`,
+		},
+		{name: "lenient coercion failing", input: `{"title": "Fix", "count": "two"}`, mode: MCPArgumentValidationLenient, expectedError: `want "integer"`},
+		{name: "invalid json", input: `{"title": `, mode: MCPArgumentValidationStrict, expectedError: "arguments are not valid JSON"},
+		{name: "off by default", input: `{"count": "x"}`, expectedInput: `{"count": "x"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// When
+			input, err := validateMCPArguments(tt.input, schema, tt.mode)
+
+			// Then
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected an error mentioning %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if input != tt.expectedInput {
+				t.Fatalf("unexpected input: %s", input)
+			}
+		})
+	}
+}
+
+func TestMCPTools_RejectsInvalidArgumentsWithoutCallingServer(t *testing.T) {
+	t.Parallel()
+	// Given
+	var calls atomic.Int32
+	server := mcp.NewServer(&mcp.Implementation{Name: "counting", Version: "1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo"}, func(_ context.Context, _ *mcp.CallToolRequest, input echoInput) (*mcp.CallToolResult, any, error) {
+		calls.Add(1)
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: input.Message}}}, nil, nil
+	})
+	sessionMaker, _ := newTestMCPSessionMaker(t, server, nil)
+	tools, err := MCPToolsWithOptions(context.Background(), sessionMaker, MCPToolsOptions{ArgumentValidation: MCPArgumentValidationStrict})
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+
+	// When
+	resp, err := tools[0].Run(context.Background(), fantasy.ToolCall{Name: "echo", Input: `{"message": 42}`})
+
+	// Then
+	if err != nil || !resp.IsError {
+		t.Fatalf("expected an error response: %+v, %v", resp, err)
+	}
+	if !strings.HasPrefix(resp.Content, "invalid arguments for tool echo: ") || !strings.Contains(resp.Content, `has type "integer", want "string"`) {
+		t.Fatalf("unexpected content: %s", resp.Content)
+	}
+	if !errors.Is(MCPToolResponseError(resp), ErrMCPInvalidArguments) {
+		t.Fatalf("expected invalid arguments error: %s", resp.Metadata)
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("expected the server not to be called")
+	}
+}